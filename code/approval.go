@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// Tags agents add to an approval ticket to decide it. Solving the ticket without a tag approves it
+const (
+	approveLabel = "approve"
+	rejectLabel  = "reject"
+)
+
+// approvalTriggeredEventData is approval.triggered plus the data of the earlier tasks of the sequence
+// Keptn passes along, e.g. the image of the configuration change and the evaluation
+type approvalTriggeredEventData struct {
+	keptnv2.ApprovalTriggeredEventData
+	ConfigurationChange keptnv2.ConfigurationChange `json:"configurationChange"`
+	Evaluation          *keptnv2.EvaluationDetails  `json:"evaluation,omitempty"`
+}
+
+// Image returns the image of the configuration change that waits for the approval, if any
+func (d *approvalTriggeredEventData) Image() string {
+	if image, ok := d.ConfigurationChange.Values["image"].(string); ok {
+		return image
+	}
+	return ""
+}
+
+// Sends approval.started for approval.triggered events with a manual approval strategy and opens an approval ticket
+// The approvalWatcher sends approval.finished once the ticket is decided. An approval that cannot be opened,
+// e.g. because of a broken template or a ticket Zendesk rejects, is finished as errored so that the sequence does not wait forever
+func HandleApprovalTriggeredEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *approvalTriggeredEventData) error {
+	slog.InfoContext(ctx, "Handling approval.triggered event")
+
+	settings := loadZendeskConfig(ctx, myKeptn).SettingsFor(keptnv2.ApprovalTaskName)
+
+	if !settings.IsEnabled(cfg.Zendesk.TicketForApprovals) {
+		slog.InfoContext(ctx, "Approvals in Zendesk are disabled (TicketForApprovals flag or zendesk.yaml). Got an approval.triggered from Keptn but doing nothing")
+		return nil
+	}
+
+	// Automatic approvals are left to Keptn's approval-service
+	if !isManualApproval(data) {
+		slog.InfoContext(ctx, "Approval strategy is not manual. Doing nothing", "result", data.Result)
+		return nil
+	}
+
+	// A redelivery neither sends approval.started again nor creates a second ticket, see approvalTickets
+	key := idempotencyKey(incomingEvent, myKeptn.KeptnContext)
+	ticketID, started := approvalTickets.get(key)
+	if !started {
+		// Keptn learns about the approval before Zendesk is called, the ticket may take a while
+		if _, err := myKeptn.SendTaskStartedEvent(&keptnv2.ApprovalStartedEventData{}, ServiceName); err != nil {
+			slog.WarnContext(ctx, "Could not send approval.started", "error", err)
+		}
+		approvalTickets.set(key, 0)
+	}
+
+	if pendingApprovals == nil {
+		return finishErroredApproval(ctx, myKeptn, key, "Approval gate is not running")
+	}
+
+	if ticketID == 0 {
+		var err error
+		ticketID, err = createZendeskTicketForApprovalTriggered(ctx, cfg, myKeptn, data, settings)
+		if err != nil {
+			slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+			if isPermanent(err) {
+				return finishErroredApproval(ctx, myKeptn, key, "Could not create Zendesk ticket: "+err.Error())
+			}
+			return err
+		}
+		approvalTickets.set(key, ticketID)
+	}
+
+	// An approval that is not persisted would be lost on restart, so have the event redelivered
+	if err := pendingApprovals.add(pendingApproval{
+		TicketID:     ticketID,
+		KeptnContext: myKeptn.KeptnContext,
+		Event:        incomingEvent,
+		CreatedAt:    time.Now().UTC(),
+	}); err != nil {
+		return transientError(fmt.Errorf("could not persist the approval of ticket %d: %w", ticketID, err))
+	}
+	approvalTickets.forget(key)
+
+	ticketURL := cfg.Zendesk.TicketURL(ticketID)
+	slog.InfoContext(ctx, "Waiting for approval", "ticketURL", ticketURL)
+	return nil
+}
+
+// Sends approval.finished with status errored for an approval that cannot be decided in Zendesk
+func finishErroredApproval(ctx context.Context, myKeptn *keptnv2.Keptn, key string, message string) error {
+	finished := &keptnv2.ApprovalFinishedEventData{
+		EventData: keptnv2.EventData{
+			Status:  keptnv2.StatusErrored,
+			Result:  keptnv2.ResultFailed,
+			Message: message,
+		},
+	}
+	if _, err := myKeptn.SendTaskFinishedEvent(finished, ServiceName); err != nil {
+		// The sequence waits for approval.finished, so have the event redelivered
+		return transientError(fmt.Errorf("could not send approval.finished: %w", err))
+	}
+	approvalTickets.forget(key)
+	slog.WarnContext(ctx, "Sent errored approval.finished", "message", message)
+	return nil
+}
+
+// Returns whether Keptn asks for a manual approval for the result of the sequence
+func isManualApproval(data *approvalTriggeredEventData) bool {
+	switch data.Result {
+	case keptnv2.ResultPass:
+		return data.Approval.Pass == keptnv2.ApprovalManual
+	case keptnv2.ResultWarning:
+		return data.Approval.Warning == keptnv2.ApprovalManual
+	}
+	return false
+}
+
+func createZendeskTicketForApprovalTriggered(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *approvalTriggeredEventData, settings TicketSettings) (int64, error) {
+	slog.DebugContext(ctx, "Creating Zendesk body details for approval.triggered")
+
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, string(data.Result), data)
+	title, bodyContent, err := renderTicket(ctx, myKeptn, keptnv2.ApprovalTaskName, settings.Template, templateData)
+	if err != nil {
+		// Broken templates fail again on redelivery
+		return 0, permanentError(err)
+	}
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      title,
+		Body:         bodyContent,
+		Labels:       append(createZendeskLabels(keptnv2.ApprovalTaskName, data.EventData, string(data.Result)), settings.Tags...),
+		Priority:     settings.Priority,
+		GroupID:      settings.GroupID,
+		Agent:        settings.agentFields(),
+		// Every approval is a decision of its own
+		Type:       settings.ticketType("task"),
+		Standalone: true,
+	}
+
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
+}
+
+// pendingApproval is an approval.triggered event waiting for its Zendesk ticket to be decided
+type pendingApproval struct {
+	TicketID     int64             `json:"ticketId"`
+	KeptnContext string            `json:"keptnContext"`
+	Event        cloudevents.Event `json:"event"`
+	CreatedAt    time.Time         `json:"createdAt"`
+}
+
+// approvalWatcher polls the tickets of pending approvals and sends approval.finished once they are decided
+// Pending approvals are kept in APPROVAL_STATE_FILE (if set) so that they survive restarts
+type approvalWatcher struct {
+	config *configSource
+
+	mu sync.Mutex
+	// checking serializes checks of the poll loop and the webhook, so that an approval is finished once
+	checking     sync.Mutex
+	stateFile    string
+	pollInterval time.Duration
+	pending      map[int64]pendingApproval
+	// checks are tickets the poll loop checks right away, see requestCheck
+	checks chan int64
+}
+
+// Tickets queued for an immediate check. Beyond that, changes are picked up by the next poll
+const approvalCheckQueueSize = 100
+
+// The approval gate, started in _main
+var pendingApprovals *approvalWatcher
+
+func newApprovalWatcher(config *configSource, stateFile string, pollInterval time.Duration) (*approvalWatcher, error) {
+	if pollInterval <= 0 {
+		pollInterval = time.Minute
+	}
+	w := &approvalWatcher{config: config, stateFile: stateFile, pollInterval: pollInterval, pending: map[int64]pendingApproval{}, checks: make(chan int64, approvalCheckQueueSize)}
+	if stateFile == "" {
+		return w, nil
+	}
+
+	content, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read approval state: %w", err)
+	}
+
+	approvals := []pendingApproval{}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &approvals); err != nil {
+			return nil, fmt.Errorf("could not decode approval state %s: %w", stateFile, err)
+		}
+	}
+	for _, approval := range approvals {
+		w.pending[approval.TicketID] = approval
+	}
+	slog.Info("Loaded pending approvals", "count", len(approvals), "file", stateFile)
+	return w, nil
+}
+
+func (w *approvalWatcher) add(approval pendingApproval) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[approval.TicketID] = approval
+	return w.save()
+}
+
+func (w *approvalWatcher) remove(ticketID int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.pending, ticketID)
+	return w.save()
+}
+
+func (w *approvalWatcher) list() []pendingApproval {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	approvals := []pendingApproval{}
+	for _, approval := range w.pending {
+		approvals = append(approvals, approval)
+	}
+	return approvals
+}
+
+// save writes the pending approvals via a temporary file and a rename. Callers hold mu
+func (w *approvalWatcher) save() error {
+	if w.stateFile == "" {
+		return nil
+	}
+
+	approvals := []pendingApproval{}
+	for _, approval := range w.pending {
+		approvals = append(approvals, approval)
+	}
+	content, err := json.Marshal(approvals)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(w.stateFile), ".approvals-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), w.stateFile)
+}
+
+// run checks the pending approvals every pollInterval until ctx is done
+func (w *approvalWatcher) run(ctx context.Context) {
+	slog.InfoContext(ctx, "Watching approval tickets", "pollInterval", w.pollInterval.String())
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ticketID := <-w.checks:
+			w.checkTicket(ctx, ticketID)
+			continue
+		case <-ticker.C:
+		}
+
+		for _, approval := range w.list() {
+			if ctx.Err() != nil {
+				return
+			}
+			w.check(ctx, approval)
+		}
+	}
+}
+
+// requestCheck has the poll loop check the approval of a ticket right away, e.g. when a Zendesk webhook
+// reported a change. It does not wait for the check
+func (w *approvalWatcher) requestCheck(ticketID int64) {
+	select {
+	case w.checks <- ticketID:
+	default:
+		slog.Debug("Approval check queue is full, leaving the ticket to the next poll", "ticketID", ticketID)
+	}
+}
+
+// checkTicket checks the approval of a ticket if it is pending
+func (w *approvalWatcher) checkTicket(ctx context.Context, ticketID int64) {
+	w.mu.Lock()
+	approval, ok := w.pending[ticketID]
+	w.mu.Unlock()
+	if ok {
+		w.check(ctx, approval)
+	}
+}
+
+// check looks at the ticket of an approval and finishes the approval once the ticket is decided
+func (w *approvalWatcher) check(ctx context.Context, approval pendingApproval) {
+	w.checking.Lock()
+	defer w.checking.Unlock()
+
+	// Log lines carry the fields of the approval.triggered event
+	ctx = withEventLogFields(ctx, approval.Event)
+
+	// Finished by a concurrent check
+	w.mu.Lock()
+	_, ok := w.pending[approval.TicketID]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	client, err := newZendeskClient(w.config.Load().Zendesk)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk client", "error", err)
+		return
+	}
+
+	decided, result, message, err := approvalDecision(ctx, client, approval.TicketID)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not check approval ticket", "ticketID", approval.TicketID, "error", err)
+		return
+	}
+	if !decided {
+		return
+	}
+
+	if err := sendApprovalFinished(approval, result, message); err != nil {
+		slog.WarnContext(ctx, "Could not send approval.finished, retrying", "ticketID", approval.TicketID, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Sent approval.finished", "ticketID", approval.TicketID, "result", result, "message", message)
+
+	if err := w.remove(approval.TicketID); err != nil {
+		slog.ErrorContext(ctx, "Could not update the approval state", "error", err)
+	}
+}
+
+// Returns whether the ticket is decided and whether it was approved (pass) or rejected (fail)
+// A reject tag wins over an approve tag. A solved or closed ticket without tags is approved, a deleted ticket is rejected
+// End users cannot read tickets with tags, for them only solving the ticket approves it
+func approvalDecision(ctx context.Context, client *zendesk.Client, ticketID int64) (bool, keptnv2.ResultType, string, error) {
+	link := client.TicketURL(ticketID)
+
+	ticket, err := client.GetTicket(ctx, ticketID)
+	if zendesk.IsForbidden(err) {
+		request, err := client.GetRequest(ctx, ticketID)
+		if err != nil {
+			return false, "", "", err
+		}
+		ticket = &zendesk.Ticket{ID: request.ID, Status: request.Status}
+	} else if zendesk.IsNotFound(err) {
+		return true, keptnv2.ResultFailed, "Rejected: approval ticket " + link + " was deleted", nil
+	} else if err != nil {
+		return false, "", "", err
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range ticket.Tags {
+		tags[strings.ToLower(tag)] = true
+	}
+
+	switch {
+	case tags[rejectLabel]:
+		return true, keptnv2.ResultFailed, "Rejected in Zendesk ticket " + link, nil
+	case tags[approveLabel]:
+		return true, keptnv2.ResultPass, "Approved in Zendesk ticket " + link, nil
+	case ticket.Status == zendesk.StatusSolved || ticket.Status == zendesk.StatusClosed:
+		return true, keptnv2.ResultPass, "Approved by solving Zendesk ticket " + link, nil
+	}
+	return false, "", "", nil
+}
+
+// Sends approval.finished for the approval.triggered event of a pending approval
+func sendApprovalFinished(approval pendingApproval, result keptnv2.ResultType, message string) error {
+	event := approval.Event
+	myKeptn, err := newKeptnHandler(&event)
+	if err != nil {
+		return fmt.Errorf("could not create Keptn Handler: %w", err)
+	}
+
+	finished := &keptnv2.ApprovalFinishedEventData{
+		EventData: keptnv2.EventData{
+			Status:  keptnv2.StatusSucceeded,
+			Result:  result,
+			Message: message,
+		},
+	}
+	_, err = myKeptn.SendTaskFinishedEvent(finished, ServiceName)
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestApprovalWatcherRequestCheck(t *testing.T) {
+	w, err := newApprovalWatcher(nil, "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A full queue must not block the webhook
+	done := make(chan struct{})
+	go func() {
+		for ticketID := int64(1); ticketID <= approvalCheckQueueSize+1; ticketID++ {
+			w.requestCheck(ticketID)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("requestCheck blocked")
+	}
+
+	if len(w.checks) != approvalCheckQueueSize {
+		t.Errorf("queued checks = %d, want %d", len(w.checks), approvalCheckQueueSize)
+	}
+	if ticketID := <-w.checks; ticketID != 1 {
+		t.Errorf("first queued check = %d, want 1", ticketID)
+	}
+}
+
+func TestApprovalDecision(t *testing.T) {
+	ticket := func(body string) map[string]fakeResponse {
+		return map[string]fakeResponse{"GET /api/v2/tickets/42.json": {status: http.StatusOK, body: body}}
+	}
+
+	tests := []struct {
+		name        string
+		responses   map[string]fakeResponse
+		wantDecided bool
+		wantResult  keptnv2.ResultType
+		wantMessage string
+		wantErr     bool
+		wantCalls   []string
+	}{
+		{name: "open", responses: ticket(`{"ticket":{"id":42,"status":"open","tags":["keptn_task:approval"]}}`)},
+		{
+			name:        "approve tag",
+			responses:   ticket(`{"ticket":{"id":42,"status":"open","tags":["Approve"]}}`),
+			wantDecided: true,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "Approved in Zendesk ticket",
+		},
+		{
+			name:        "reject tag",
+			responses:   ticket(`{"ticket":{"id":42,"status":"open","tags":["reject"]}}`),
+			wantDecided: true,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "Rejected in Zendesk ticket",
+		},
+		{
+			name:        "reject wins over approve",
+			responses:   ticket(`{"ticket":{"id":42,"status":"solved","tags":["approve","reject"]}}`),
+			wantDecided: true,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "Rejected in Zendesk ticket",
+		},
+		{
+			name:        "solved",
+			responses:   ticket(`{"ticket":{"id":42,"status":"solved"}}`),
+			wantDecided: true,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "Approved by solving Zendesk ticket",
+		},
+		{
+			name:        "closed",
+			responses:   ticket(`{"ticket":{"id":42,"status":"closed"}}`),
+			wantDecided: true,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "Approved by solving Zendesk ticket",
+		},
+		{
+			name:        "deleted",
+			wantDecided: true,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "was deleted",
+		},
+		{
+			name: "end user solved the request",
+			responses: map[string]fakeResponse{
+				"GET /api/v2/tickets/42.json":  {status: http.StatusForbidden},
+				"GET /api/v2/requests/42.json": {status: http.StatusOK, body: `{"request":{"id":42,"status":"solved"}}`},
+			},
+			wantDecided: true,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "Approved by solving Zendesk ticket",
+			wantCalls:   []string{"GET /api/v2/tickets/42.json", "GET /api/v2/requests/42.json"},
+		},
+		{
+			name: "end user request is open",
+			responses: map[string]fakeResponse{
+				"GET /api/v2/tickets/42.json":  {status: http.StatusForbidden},
+				"GET /api/v2/requests/42.json": {status: http.StatusOK, body: `{"request":{"id":42,"status":"open"}}`},
+			},
+			wantCalls: []string{"GET /api/v2/tickets/42.json", "GET /api/v2/requests/42.json"},
+		},
+		{
+			name:      "request not readable either",
+			responses: map[string]fakeResponse{"GET /api/v2/tickets/42.json": {status: http.StatusForbidden}, "GET /api/v2/requests/42.json": {status: http.StatusForbidden}},
+			wantErr:   true,
+			wantCalls: []string{"GET /api/v2/tickets/42.json", "GET /api/v2/requests/42.json"},
+		},
+		{name: "zendesk fails", responses: map[string]fakeResponse{"GET /api/v2/tickets/42.json": {status: http.StatusBadRequest}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := newFakeZendesk(t, tt.responses)
+			client, err := buildZendeskClient(fakeZendeskConfig(zd).Zendesk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decided, result, message, err := approvalDecision(context.Background(), client, 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("approvalDecision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if decided != tt.wantDecided || result != tt.wantResult {
+				t.Errorf("approvalDecision() = %v, %q, want %v, %q", decided, result, tt.wantDecided, tt.wantResult)
+			}
+			if !strings.Contains(message, tt.wantMessage) || (decided && !strings.Contains(message, client.TicketURL(42))) {
+				t.Errorf("message = %q, want %q and the ticket link", message, tt.wantMessage)
+			}
+			wantCalls := tt.wantCalls
+			if wantCalls == nil {
+				wantCalls = []string{"GET /api/v2/tickets/42.json"}
+			}
+			if calls := zd.called(); !reflect.DeepEqual(calls, wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, wantCalls)
+			}
+		})
+	}
+}
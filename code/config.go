@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Config is the configuration of the service, see loadConfig. It is handed to the handlers, which must not modify it.
+// A reload creates a new Config, see configSource
+type Config struct {
+	envConfig
+	Zendesk   ZendeskDetails
+	Keptn     KeptnDetails
+	Dynatrace DynatraceDetails
+}
+
+// Values of ZENDESK_AUTH_METHOD
+const (
+	// API token of ZENDESK_END_USER_EMAIL (email/token basic auth)
+	zendeskAuthToken = "token"
+	// OAuth access token in ZENDESK_OAUTH_ACCESS_TOKEN
+	zendeskAuthBearer = "bearer"
+	// OAuth access tokens requested with the client credentials grant
+	zendeskAuthClientCredentials = "client_credentials"
+)
+
+// ZendeskDetails is how the service talks to Zendesk and which Keptn events open tickets by default
+type ZendeskDetails struct {
+	BaseURL string `envconfig:"ZENDESK_BASE_URL"`
+	// How requests are authenticated: token, bearer or client_credentials, see zendeskAuthenticator
+	AuthMethod   string `envconfig:"ZENDESK_AUTH_METHOD" default:"token"`
+	EndUserEmail string `envconfig:"ZENDESK_END_USER_EMAIL"`
+	APIToken     string `envconfig:"ZENDESK_API_TOKEN"`
+	// Access token of the bearer method
+	OAuthAccessToken string `envconfig:"ZENDESK_OAUTH_ACCESS_TOKEN"`
+	// OAuth client of the client_credentials method
+	OAuthClientID     string `envconfig:"ZENDESK_OAUTH_CLIENT_ID"`
+	OAuthClientSecret string `envconfig:"ZENDESK_OAUTH_CLIENT_SECRET"`
+	OAuthScope        string `envconfig:"ZENDESK_OAUTH_SCOPE" default:"read write"`
+	// Defaults to ZENDESK_BASE_URL/oauth/tokens
+	OAuthTokenURL string `envconfig:"ZENDESK_OAUTH_TOKEN_URL"`
+
+	TicketForProblems    bool `envconfig:"ZENDESK_TICKET_FOR_PROBLEMS" default:"false"`
+	TicketForEvaluations bool `envconfig:"ZENDESK_TICKET_FOR_EVALUATIONS" default:"false"`
+	TicketForDeployments bool `envconfig:"ZENDESK_TICKET_FOR_DEPLOYMENTS" default:"false"`
+	TicketForTests       bool `envconfig:"ZENDESK_TICKET_FOR_TESTS" default:"false"`
+	TicketForReleases    bool `envconfig:"ZENDESK_TICKET_FOR_RELEASES" default:"false"`
+	TicketForApprovals   bool `envconfig:"ZENDESK_TICKET_FOR_APPROVALS" default:"false"`
+	// Number of retries for calls that Zendesk rejects with 429 / 5xx
+	MaxRetries int `envconfig:"ZENDESK_MAX_RETRIES" default:"3"`
+	// What to do with tickets of failed evaluations once the service passes again
+	RecoveryPolicy string `envconfig:"ZENDESK_RECOVERY_POLICY" default:"solve"`
+}
+
+// KeptnDetails are the links to Keptn put into the tickets
+type KeptnDetails struct {
+	Domain string `envconfig:"KEPTN_DOMAIN"`
+	// Defaults to KEPTN_DOMAIN
+	BridgeURL string `envconfig:"KEPTN_BRIDGE_URL"`
+}
+
+// DynatraceDetails are used by the dynatrace sink
+type DynatraceDetails struct {
+	Tenant   string `envconfig:"DT_TENANT"`
+	APIToken string `envconfig:"DT_API_TOKEN"`
+	// CUSTOM_INFO, CUSTOM_ANNOTATION or CUSTOM_CONFIGURATION
+	EventType string `envconfig:"DT_EVENT_TYPE" default:"CUSTOM_INFO"`
+}
+
+// Values that are masked in the logs, see redact
+func (c *Config) secrets() []string {
+	return []string{c.Zendesk.APIToken, c.Zendesk.OAuthAccessToken, c.Zendesk.OAuthClientSecret, c.Dynatrace.APIToken, c.WebhookSecret}
+}
+
+// TicketURL returns the agent UI link for a ticket
+func (z ZendeskDetails) TicketURL(ticketID int64) string {
+	return z.BaseURL + "/agent/tickets/" + strconv.FormatInt(ticketID, 10)
+}
+
+// BridgeLink returns the link to a sequence in the Keptn Bridge
+func (k KeptnDetails) BridgeLink(project string, keptnContext string) string {
+	return k.BridgeURL + "/project/" + project + "/sequence/" + keptnContext
+}
+
+// Reads the configuration from the environment and the files in CONFIG_DIR, which win over the environment.
+// Values that cannot be parsed, e.g. ZENDESK_TICKET_FOR_TESTS=yes, are errors. Mandatory settings and formats
+// are checked by validate
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	for _, spec := range []interface{}{&cfg.envConfig, &cfg.Zendesk, &cfg.Keptn, &cfg.Dynatrace} {
+		if err := envconfig.Process("", spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ConfigDir != "" {
+		files, err := readConfigDir(cfg.ConfigDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, setting := range cfg.settings() {
+			if value, ok := files[setting.name]; ok && setting.name != "CONFIG_DIR" {
+				if err := setting.set(value); err != nil {
+					return nil, fmt.Errorf("%s: %w", filepath.Join(cfg.ConfigDir, value.file), err)
+				}
+			}
+		}
+	}
+
+	// Links are built by appending paths
+	cfg.Zendesk.BaseURL = strings.TrimRight(cfg.Zendesk.BaseURL, "/")
+	if cfg.Zendesk.OAuthTokenURL == "" && cfg.Zendesk.BaseURL != "" {
+		cfg.Zendesk.OAuthTokenURL = cfg.Zendesk.BaseURL + "/oauth/tokens"
+	}
+	cfg.Keptn.Domain = strings.TrimRight(cfg.Keptn.Domain, "/")
+	cfg.Keptn.BridgeURL = strings.TrimRight(cfg.Keptn.BridgeURL, "/")
+	if cfg.Keptn.BridgeURL == "" {
+		cfg.Keptn.BridgeURL = cfg.Keptn.Domain
+	}
+
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+		if cfg.Debug {
+			cfg.LogLevel = "debug"
+		}
+	}
+	return cfg, nil
+}
+
+// A setting of the configuration, i.e. a field with an envconfig tag
+type configSetting struct {
+	name  string
+	value reflect.Value
+	// Whether a reload takes effect right away. The others are only read at startup
+	live bool
+}
+
+// Settings of envConfig that take effect on reload, all of Zendesk, Keptn and Dynatrace do
+var liveEnvSettings = map[string]bool{
+	"ZENDESK_WEBHOOK_SECRET": true,
+}
+
+// Lists all settings of the configuration
+func (c *Config) settings() []configSetting {
+	sections := []struct {
+		spec interface{}
+		live bool
+	}{{&c.envConfig, false}, {&c.Zendesk, true}, {&c.Keptn, true}, {&c.Dynatrace, true}}
+
+	settings := []configSetting{}
+	for _, section := range sections {
+		value := reflect.ValueOf(section.spec).Elem()
+		for i := 0; i < value.NumField(); i++ {
+			name := value.Type().Field(i).Tag.Get("envconfig")
+			if name == "" {
+				continue
+			}
+			settings = append(settings, configSetting{name: name, value: value.Field(i), live: section.live || liveEnvSettings[name]})
+		}
+	}
+	return settings
+}
+
+// Parses a value the way envconfig does
+func (s configSetting) set(value configFileValue) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(value.value)
+	case bool:
+		b, err := strconv.ParseBool(value.value)
+		if err != nil {
+			return fmt.Errorf("%s is not a boolean: %w", s.name, err)
+		}
+		s.value.SetBool(b)
+	case int:
+		i, err := strconv.Atoi(value.value)
+		if err != nil {
+			return fmt.Errorf("%s is not a number: %w", s.name, err)
+		}
+		s.value.SetInt(int64(i))
+	case time.Duration:
+		d, err := time.ParseDuration(value.value)
+		if err != nil {
+			return fmt.Errorf("%s is not a duration: %w", s.name, err)
+		}
+		s.value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("%s cannot be read from a file", s.name)
+	}
+	return nil
+}
+
+// Names of the settings that differ between two configurations, e.g. ZENDESK_API_TOKEN. Values are left out
+func changedSettings(previous *Config, current *Config) (live []string, restart []string) {
+	previousSettings := previous.settings()
+	for i, setting := range current.settings() {
+		if reflect.DeepEqual(setting.value.Interface(), previousSettings[i].value.Interface()) {
+			continue
+		}
+		if setting.live {
+			live = append(live, setting.name)
+		} else {
+			restart = append(restart, setting.name)
+		}
+	}
+	return live, restart
+}
+
+// configFileValue is the content of a file in CONFIG_DIR
+type configFileValue struct {
+	file  string
+	value string
+}
+
+// Reads the settings in dir. A file is named after its setting, e.g. ZENDESK_API_TOKEN or zendesk-api-token,
+// and holds the value, surrounding whitespace is ignored. Files of unknown settings are ignored as well, as are
+// hidden files and directories, e.g. the ..data directory of a Kubernetes secret volume
+func readConfigDir(dir string) (map[string]configFileValue, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CONFIG_DIR: %w", err)
+	}
+
+	files := map[string]configFileValue{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Secret volumes consist of symlinks
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+
+		name := strings.ToUpper(strings.ReplaceAll(entry.Name(), "-", "_"))
+		if other, ok := files[name]; ok {
+			return nil, fmt.Errorf("%s and %s both set %s", other.file, entry.Name(), name)
+		}
+		files[name] = configFileValue{file: entry.Name(), value: strings.TrimSpace(string(content))}
+	}
+	return files, nil
+}
+
+// Checks mandatory settings, URLs and enumerations. All problems are reported at once
+func (c *Config) validate() error {
+	problems := []string{}
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	check(validateURL("ZENDESK_BASE_URL", c.Zendesk.BaseURL))
+	switch c.Zendesk.AuthMethod {
+	case zendeskAuthToken:
+		if c.Zendesk.EndUserEmail == "" {
+			check(errors.New("ZENDESK_END_USER_EMAIL is missing"))
+		} else if _, err := mail.ParseAddress(c.Zendesk.EndUserEmail); err != nil {
+			check(fmt.Errorf("ZENDESK_END_USER_EMAIL is not an e-mail address: %w", err))
+		}
+		if c.Zendesk.APIToken == "" {
+			check(errors.New("ZENDESK_API_TOKEN is missing"))
+		}
+	case zendeskAuthBearer:
+		if c.Zendesk.OAuthAccessToken == "" {
+			check(errors.New("ZENDESK_OAUTH_ACCESS_TOKEN is missing"))
+		}
+	case zendeskAuthClientCredentials:
+		if c.Zendesk.OAuthClientID == "" || c.Zendesk.OAuthClientSecret == "" {
+			check(errors.New("ZENDESK_OAUTH_CLIENT_ID and ZENDESK_OAUTH_CLIENT_SECRET are missing"))
+		}
+		check(validateURL("ZENDESK_OAUTH_TOKEN_URL", c.Zendesk.OAuthTokenURL))
+	default:
+		check(fmt.Errorf("unknown ZENDESK_AUTH_METHOD %q, expected %s, %s or %s", c.Zendesk.AuthMethod, zendeskAuthToken, zendeskAuthBearer, zendeskAuthClientCredentials))
+	}
+	if c.Zendesk.MaxRetries < 0 {
+		check(fmt.Errorf("ZENDESK_MAX_RETRIES must not be negative, got %d", c.Zendesk.MaxRetries))
+	}
+	if !isValidRecoveryPolicy(c.Zendesk.RecoveryPolicy) {
+		check(fmt.Errorf("unknown ZENDESK_RECOVERY_POLICY %q, expected %s, %s or %s", c.Zendesk.RecoveryPolicy, recoveryPolicySolve, recoveryPolicyComment, recoveryPolicyLeave))
+	}
+
+	check(validateURL("KEPTN_DOMAIN", c.Keptn.Domain))
+	if c.Keptn.BridgeURL != c.Keptn.Domain {
+		check(validateURL("KEPTN_BRIDGE_URL", c.Keptn.BridgeURL))
+	}
+
+	switch c.Dynatrace.EventType {
+	case DtEventTypeInfo, DtEventTypeAnnotation, DtEventTypeConfiguration:
+	default:
+		check(fmt.Errorf("unknown DT_EVENT_TYPE %q, expected %s, %s or %s", c.Dynatrace.EventType, DtEventTypeInfo, DtEventTypeAnnotation, DtEventTypeConfiguration))
+	}
+
+	if c.WebhookPort != 0 && c.WebhookSecret == "" {
+		check(errors.New("ZENDESK_WEBHOOK_SECRET must be set to receive Zendesk webhooks"))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// A mandatory absolute http(s) URL
+func validateURL(name string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is missing", name)
+	}
+	if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s %q must be an absolute http(s) URL", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// A configuration that passes validate
+func validConfig() *Config {
+	return &Config{
+		Zendesk: ZendeskDetails{
+			BaseURL:        "https://acme.zendesk.com",
+			AuthMethod:     zendeskAuthToken,
+			EndUserEmail:   "jane@example.com",
+			APIToken:       "api-token",
+			RecoveryPolicy: recoveryPolicySolve,
+		},
+		Keptn: KeptnDetails{
+			Domain:    "https://keptn.example.com",
+			BridgeURL: "https://keptn.example.com/bridge",
+		},
+		Dynatrace: DynatraceDetails{EventType: DtEventTypeInfo},
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		// Substrings of the error, none means valid
+		wantErrs []string
+	}{
+		{name: "valid", modify: func(cfg *Config) {}},
+		{name: "bridge defaults to the domain", modify: func(cfg *Config) { cfg.Keptn.BridgeURL = cfg.Keptn.Domain }},
+		{
+			name:     "missing base URL",
+			modify:   func(cfg *Config) { cfg.Zendesk.BaseURL = "" },
+			wantErrs: []string{"ZENDESK_BASE_URL is missing"},
+		},
+		{
+			name:     "relative base URL",
+			modify:   func(cfg *Config) { cfg.Zendesk.BaseURL = "acme.zendesk.com" },
+			wantErrs: []string{`ZENDESK_BASE_URL "acme.zendesk.com" must be an absolute http(s) URL`},
+		},
+		{
+			name:     "missing token credentials",
+			modify:   func(cfg *Config) { cfg.Zendesk.EndUserEmail = ""; cfg.Zendesk.APIToken = "" },
+			wantErrs: []string{"ZENDESK_END_USER_EMAIL is missing", "ZENDESK_API_TOKEN is missing"},
+		},
+		{
+			name:     "invalid e-mail",
+			modify:   func(cfg *Config) { cfg.Zendesk.EndUserEmail = "jane" },
+			wantErrs: []string{"ZENDESK_END_USER_EMAIL is not an e-mail address"},
+		},
+		{
+			name: "bearer",
+			modify: func(cfg *Config) {
+				cfg.Zendesk = ZendeskDetails{BaseURL: "https://acme.zendesk.com", AuthMethod: zendeskAuthBearer, OAuthAccessToken: "access", RecoveryPolicy: recoveryPolicyLeave}
+			},
+		},
+		{
+			name:     "bearer without token",
+			modify:   func(cfg *Config) { cfg.Zendesk.AuthMethod = zendeskAuthBearer },
+			wantErrs: []string{"ZENDESK_OAUTH_ACCESS_TOKEN is missing"},
+		},
+		{
+			name: "client credentials",
+			modify: func(cfg *Config) {
+				cfg.Zendesk.AuthMethod = zendeskAuthClientCredentials
+				cfg.Zendesk.OAuthClientID = "keptn"
+				cfg.Zendesk.OAuthClientSecret = "secret"
+				cfg.Zendesk.OAuthTokenURL = "https://acme.zendesk.com/oauth/tokens"
+			},
+		},
+		{
+			name:     "client credentials without client",
+			modify:   func(cfg *Config) { cfg.Zendesk.AuthMethod = zendeskAuthClientCredentials },
+			wantErrs: []string{"ZENDESK_OAUTH_CLIENT_ID and ZENDESK_OAUTH_CLIENT_SECRET are missing", "ZENDESK_OAUTH_TOKEN_URL is missing"},
+		},
+		{
+			name:     "unknown auth method",
+			modify:   func(cfg *Config) { cfg.Zendesk.AuthMethod = "password" },
+			wantErrs: []string{`unknown ZENDESK_AUTH_METHOD "password"`},
+		},
+		{
+			name:     "negative retries",
+			modify:   func(cfg *Config) { cfg.Zendesk.MaxRetries = -1 },
+			wantErrs: []string{"ZENDESK_MAX_RETRIES must not be negative"},
+		},
+		{
+			name:     "unknown recovery policy",
+			modify:   func(cfg *Config) { cfg.Zendesk.RecoveryPolicy = "close" },
+			wantErrs: []string{`unknown ZENDESK_RECOVERY_POLICY "close"`},
+		},
+		{
+			name:     "missing Keptn domain",
+			modify:   func(cfg *Config) { cfg.Keptn.Domain = "" },
+			wantErrs: []string{"KEPTN_DOMAIN is missing"},
+		},
+		{
+			name:     "invalid bridge URL",
+			modify:   func(cfg *Config) { cfg.Keptn.BridgeURL = "ftp://keptn.example.com" },
+			wantErrs: []string{"KEPTN_BRIDGE_URL"},
+		},
+		{
+			name:     "unknown Dynatrace event type",
+			modify:   func(cfg *Config) { cfg.Dynatrace.EventType = "CUSTOM_ALERT" },
+			wantErrs: []string{`unknown DT_EVENT_TYPE "CUSTOM_ALERT"`},
+		},
+		{
+			name:     "webhook without secret",
+			modify:   func(cfg *Config) { cfg.WebhookPort = 8082 },
+			wantErrs: []string{"ZENDESK_WEBHOOK_SECRET must be set"},
+		},
+		{
+			name:   "webhook with secret",
+			modify: func(cfg *Config) { cfg.WebhookPort = 8082; cfg.WebhookSecret = "signing-secret" },
+		},
+		{
+			name: "all problems at once",
+			modify: func(cfg *Config) {
+				cfg.Zendesk.BaseURL = ""
+				cfg.Keptn.Domain = ""
+				cfg.Dynatrace.EventType = ""
+			},
+			wantErrs: []string{"ZENDESK_BASE_URL is missing", "KEPTN_DOMAIN is missing", "unknown DT_EVENT_TYPE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.validate()
+
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() = nil, want %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
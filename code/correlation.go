@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// ticketCorrelator maps a Keptn context (i.e. one Keptn sequence) onto the Zendesk ticket tracking it
+// The Keptn context is stored as the external_id of the ticket so the mapping survives restarts.
+// The local cache saves a Zendesk lookup for every further event of a running sequence
+type ticketCorrelator struct {
+	mu      sync.Mutex
+	tickets map[string]int64
+}
+
+var correlator = &ticketCorrelator{tickets: map[string]int64{}}
+
+// find returns the ID of the open ticket for keptnContext or 0 if there is none yet
+func (c *ticketCorrelator) find(ctx context.Context, client *zendesk.Client, keptnContext string) (int64, error) {
+	if keptnContext == "" {
+		return 0, nil
+	}
+
+	c.mu.Lock()
+	ticketID, ok := c.tickets[keptnContext]
+	c.mu.Unlock()
+	if ok {
+		return ticketID, nil
+	}
+
+	tickets, err := client.ListTicketsByExternalID(ctx, keptnContext)
+	if zendesk.IsForbidden(err) {
+		slog.WarnContext(ctx, "Looking up tickets by external_id is not permitted for this Zendesk user. Relying on the local ticket cache only")
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Closed tickets cannot be updated anymore, so pick the newest ticket that is still workable
+	for _, ticket := range tickets {
+		if ticket.Status == zendesk.StatusClosed {
+			continue
+		}
+		if ticket.ID > ticketID {
+			ticketID = ticket.ID
+		}
+	}
+
+	if ticketID != 0 {
+		c.remember(keptnContext, ticketID)
+	}
+	return ticketID, nil
+}
+
+// remember stores the ticket for keptnContext in the local cache
+func (c *ticketCorrelator) remember(keptnContext string, ticketID int64) {
+	if keptnContext == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tickets[keptnContext] = ticketID
+}
+
+// forget drops keptnContext from the local cache, e.g. once its ticket has been closed
+func (c *ticketCorrelator) forget(keptnContext string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tickets, keptnContext)
+}
+
+// link stores the Keptn context as the external_id of a freshly created ticket and applies
+// the fields the Requests API does not accept (priority, group, type, assignee, custom fields)
+// End users may not be allowed to do this, in which case only the local cache knows about the ticket
+// Standalone tickets are not linked to their Keptn context
+func (c *ticketCorrelator) link(ctx context.Context, client *zendesk.Client, ticketID int64, ticket zendeskTicket) {
+	// Tickets created through the Tickets API have all fields already
+	if ticket.Agent.UseTicketsAPI {
+		if !ticket.Standalone {
+			c.remember(ticket.KeptnContext, ticketID)
+		}
+		return
+	}
+
+	update := &zendesk.Ticket{
+		Priority:     ticket.Priority,
+		GroupID:      ticket.GroupID,
+		Type:         ticket.Type,
+		AssigneeID:   ticket.Agent.AssigneeID,
+		CustomFields: ticket.Agent.CustomFields,
+	}
+	if !ticket.Standalone {
+		c.remember(ticket.KeptnContext, ticketID)
+		update.ExternalID = ticket.KeptnContext
+	}
+	if update.ExternalID == "" && update.Priority == "" && update.GroupID == 0 && update.Type == "" && update.AssigneeID == 0 && len(update.CustomFields) == 0 {
+		return
+	}
+
+	if _, err := client.UpdateTicket(ctx, ticketID, update); err != nil {
+		slog.WarnContext(ctx, "Could not set external_id / priority / group / type / assignee / custom fields of ticket", "ticketID", ticketID, "error", err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// Without results in zendesk.yaml, deployments and tests only open tickets when they did not pass
+var notPassedResults = []string{string(keptnv2.ResultFailed), string(keptnv2.ResultWarning)}
+
+func HandleDeploymentFinishedEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.DeploymentFinishedEventData) error {
+	slog.InfoContext(ctx, "Handling deployment.finished event")
+
+	settings := loadZendeskConfig(ctx, myKeptn).SettingsFor(keptnv2.DeploymentTaskName)
+
+	if !settings.IsEnabled(cfg.Zendesk.TicketForDeployments) {
+		slog.InfoContext(ctx, "Tickets for deployments are disabled (TicketForDeployments flag or zendesk.yaml). Got a deployment.finished from Keptn but doing nothing. If you want a ticket, enable them")
+		return nil
+	}
+
+	if len(settings.Results) == 0 {
+		settings.Results = notPassedResults
+	}
+	if !settings.MatchesResult(string(data.Result)) {
+		slog.InfoContext(ctx, "No ticket for deployment result", "result", data.Result)
+		return nil
+	}
+
+	ticketID, err := createZendeskTicketForDeploymentFinished(ctx, cfg, myKeptn, data, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+		return err
+	}
+	ticketURL := cfg.Zendesk.TicketURL(ticketID)
+
+	// Let the enabled sinks (SINKS) know about the ticket
+	notifySinks(ctx, Notification{
+		Kind:         keptnv2.DeploymentTaskName,
+		TicketID:     ticketID,
+		TicketURL:    ticketURL,
+		KeptnContext: myKeptn.KeptnContext,
+		EventID:      incomingEvent.ID(),
+		Project:      data.EventData.GetProject(),
+		Stage:        data.EventData.GetStage(),
+		Service:      data.EventData.GetService(),
+		Result:       string(data.Result),
+		Properties:   createCustomPropertiesForDeploymentFinishedEvents(cfg, myKeptn, data, ticketURL),
+	})
+	return nil
+}
+
+func HandleTestFinishedEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.TestFinishedEventData) error {
+	slog.InfoContext(ctx, "Handling test.finished event")
+
+	settings := loadZendeskConfig(ctx, myKeptn).SettingsFor(keptnv2.TestTaskName)
+
+	if !settings.IsEnabled(cfg.Zendesk.TicketForTests) {
+		slog.InfoContext(ctx, "Tickets for tests are disabled (TicketForTests flag or zendesk.yaml). Got a test.finished from Keptn but doing nothing. If you want a ticket, enable them")
+		return nil
+	}
+
+	if len(settings.Results) == 0 {
+		settings.Results = notPassedResults
+	}
+	if !settings.MatchesResult(string(data.Result)) {
+		slog.InfoContext(ctx, "No ticket for test result", "result", data.Result)
+		return nil
+	}
+
+	ticketID, err := createZendeskTicketForTestFinished(ctx, cfg, myKeptn, data, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+		return err
+	}
+	ticketURL := cfg.Zendesk.TicketURL(ticketID)
+
+	// Let the enabled sinks (SINKS) know about the ticket
+	notifySinks(ctx, Notification{
+		Kind:         keptnv2.TestTaskName,
+		TicketID:     ticketID,
+		TicketURL:    ticketURL,
+		KeptnContext: myKeptn.KeptnContext,
+		EventID:      incomingEvent.ID(),
+		Project:      data.EventData.GetProject(),
+		Stage:        data.EventData.GetStage(),
+		Service:      data.EventData.GetService(),
+		Result:       string(data.Result),
+		Properties:   createCustomPropertiesForTestFinishedEvents(cfg, myKeptn, data, ticketURL),
+	})
+	return nil
+}
+
+// Every release opens a change record, i.e. a ticket of type task of its own
+func HandleReleaseFinishedEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.ReleaseFinishedEventData) error {
+	slog.InfoContext(ctx, "Handling release.finished event")
+
+	settings := loadZendeskConfig(ctx, myKeptn).SettingsFor(keptnv2.ReleaseTaskName)
+
+	if !settings.IsEnabled(cfg.Zendesk.TicketForReleases) {
+		slog.InfoContext(ctx, "Tickets for releases are disabled (TicketForReleases flag or zendesk.yaml). Got a release.finished from Keptn but doing nothing. If you want a ticket, enable them")
+		return nil
+	}
+
+	if !settings.MatchesResult(string(data.Result)) {
+		slog.InfoContext(ctx, "zendesk.yaml does not want tickets for release result", "result", data.Result)
+		return nil
+	}
+
+	ticketID, err := createZendeskTicketForReleaseFinished(ctx, cfg, myKeptn, data, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+		return err
+	}
+	ticketURL := cfg.Zendesk.TicketURL(ticketID)
+
+	// Let the enabled sinks (SINKS) know about the ticket
+	notifySinks(ctx, Notification{
+		Kind:         keptnv2.ReleaseTaskName,
+		TicketID:     ticketID,
+		TicketURL:    ticketURL,
+		KeptnContext: myKeptn.KeptnContext,
+		EventID:      incomingEvent.ID(),
+		Project:      data.EventData.GetProject(),
+		Stage:        data.EventData.GetStage(),
+		Service:      data.EventData.GetService(),
+		Result:       string(data.Result),
+		Properties:   createCustomPropertiesForReleaseFinishedEvents(cfg, myKeptn, data, ticketURL),
+	})
+	return nil
+}
+
+/********************************************
+*   DEPLOYMENT.FINISHED SPECIFIC METHODS
+*********************************************/
+
+func createZendeskTicketForDeploymentFinished(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.DeploymentFinishedEventData, settings TicketSettings) (int64, error) {
+	slog.DebugContext(ctx, "Creating Zendesk body details for deployment.finished")
+
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, string(data.Result), data)
+	title, bodyContent, err := renderTicket(ctx, myKeptn, keptnv2.DeploymentTaskName, settings.Template, templateData)
+	if err != nil {
+		// Broken templates fail again on redelivery
+		return 0, permanentError(err)
+	}
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      title,
+		Body:         bodyContent,
+		Labels:       append(createZendeskLabels(keptnv2.DeploymentTaskName, data.EventData, string(data.Result)), settings.Tags...),
+		Status:       ticketStatusForResult(string(data.Result), false),
+		Priority:     settings.Priority,
+		GroupID:      settings.GroupID,
+		Type:         settings.Type,
+		Agent:        settings.agentFields(),
+	}
+
+	// Create the ticket for this sequence or add to the existing one
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
+}
+
+func createCustomPropertiesForDeploymentFinishedEvents(cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.DeploymentFinishedEventData, ticketURL string) map[string]string {
+	var customProperties = make(map[string]string)
+
+	customProperties["Result"] = string(data.Result)
+	customProperties["Deployment Strategy"] = data.Deployment.DeploymentStrategy
+	customProperties["Git Commit"] = data.Deployment.GitCommit
+	customProperties["Keptn Project"] = data.EventData.GetProject()
+	customProperties["Keptn Service"] = data.EventData.GetService()
+	customProperties["Keptn Stage"] = data.EventData.GetStage()
+	customProperties["Ticket"] = ticketURL
+	customProperties["SentBy"] = "Keptn"
+	customProperties["BridgeURL"] = cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	customProperties["Description"] = "Keptn Deployment"
+
+	return customProperties
+}
+
+/********************************************
+*   TEST.FINISHED SPECIFIC METHODS
+*********************************************/
+
+func createZendeskTicketForTestFinished(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.TestFinishedEventData, settings TicketSettings) (int64, error) {
+	slog.DebugContext(ctx, "Creating Zendesk body details for test.finished")
+
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, string(data.Result), data)
+	title, bodyContent, err := renderTicket(ctx, myKeptn, keptnv2.TestTaskName, settings.Template, templateData)
+	if err != nil {
+		// Broken templates fail again on redelivery
+		return 0, permanentError(err)
+	}
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      title,
+		Body:         bodyContent,
+		Labels:       append(createZendeskLabels(keptnv2.TestTaskName, data.EventData, string(data.Result)), settings.Tags...),
+		Status:       ticketStatusForResult(string(data.Result), false),
+		Priority:     settings.Priority,
+		GroupID:      settings.GroupID,
+		Type:         settings.Type,
+		Agent:        settings.agentFields(),
+	}
+
+	// Create the ticket for this sequence or add to the existing one
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
+}
+
+func createCustomPropertiesForTestFinishedEvents(cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.TestFinishedEventData, ticketURL string) map[string]string {
+	var customProperties = make(map[string]string)
+
+	customProperties["Result"] = string(data.Result)
+	customProperties["Test Start"] = data.Test.Start
+	customProperties["Test End"] = data.Test.End
+	customProperties["Git Commit"] = data.Test.GitCommit
+	customProperties["Keptn Project"] = data.EventData.GetProject()
+	customProperties["Keptn Service"] = data.EventData.GetService()
+	customProperties["Keptn Stage"] = data.EventData.GetStage()
+	customProperties["Ticket"] = ticketURL
+	customProperties["SentBy"] = "Keptn"
+	customProperties["BridgeURL"] = cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	customProperties["Description"] = "Keptn Test Run"
+
+	return customProperties
+}
+
+/********************************************
+*   RELEASE.FINISHED SPECIFIC METHODS
+*********************************************/
+
+func createZendeskTicketForReleaseFinished(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.ReleaseFinishedEventData, settings TicketSettings) (int64, error) {
+	slog.DebugContext(ctx, "Creating Zendesk body details for release.finished")
+
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, string(data.Result), data)
+	title, bodyContent, err := renderTicket(ctx, myKeptn, keptnv2.ReleaseTaskName, settings.Template, templateData)
+	if err != nil {
+		// Broken templates fail again on redelivery
+		return 0, permanentError(err)
+	}
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      title,
+		Body:         bodyContent,
+		Labels:       append(createZendeskLabels(keptnv2.ReleaseTaskName, data.EventData, string(data.Result)), settings.Tags...),
+		Priority:     settings.Priority,
+		GroupID:      settings.GroupID,
+		Agent:        settings.agentFields(),
+		// A change record documents the release, it is not a problem of the sequence
+		Type:       settings.ticketType("task"),
+		Standalone: true,
+	}
+
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
+}
+
+func createCustomPropertiesForReleaseFinishedEvents(cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.ReleaseFinishedEventData, ticketURL string) map[string]string {
+	var customProperties = make(map[string]string)
+
+	customProperties["Result"] = string(data.Result)
+	customProperties["Git Commit"] = data.Release.GitCommit
+	customProperties["Keptn Project"] = data.EventData.GetProject()
+	customProperties["Keptn Service"] = data.EventData.GetService()
+	customProperties["Keptn Stage"] = data.EventData.GetStage()
+	customProperties["Ticket"] = ticketURL
+	customProperties["SentBy"] = "Keptn"
+	customProperties["BridgeURL"] = cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	customProperties["Description"] = "Keptn Release (Change Record)"
+
+	return customProperties
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestDeliveryHandlers(t *testing.T) {
+	const stageResource = "/v1/project/sockshop/stage/production/resource/zendesk.yaml"
+	sequence := keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts"}
+	withResult := func(result keptnv2.ResultType) keptnv2.EventData {
+		data := sequence
+		data.Result = result
+		return data
+	}
+
+	deployment := func(result keptnv2.ResultType) func(context.Context, *Config, *keptnv2.Keptn, cloudevents.Event) error {
+		return func(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			return HandleDeploymentFinishedEvent(ctx, cfg, myKeptn, event, &keptnv2.DeploymentFinishedEventData{EventData: withResult(result)})
+		}
+	}
+	test := func(result keptnv2.ResultType) func(context.Context, *Config, *keptnv2.Keptn, cloudevents.Event) error {
+		return func(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			return HandleTestFinishedEvent(ctx, cfg, myKeptn, event, &keptnv2.TestFinishedEventData{EventData: withResult(result)})
+		}
+	}
+	release := func(result keptnv2.ResultType) func(context.Context, *Config, *keptnv2.Keptn, cloudevents.Event) error {
+		return func(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, event cloudevents.Event) error {
+			data := &keptnv2.ReleaseFinishedEventData{EventData: withResult(result)}
+			data.Release.GitCommit = "a1b2c3"
+			return HandleReleaseFinishedEvent(ctx, cfg, myKeptn, event, data)
+		}
+	}
+
+	// A ticket of the sequence: external_id lookup, creation, correlation
+	sequenceTicket := []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"}
+	responses := map[string]fakeResponse{
+		"POST /api/v2/requests.json": {status: http.StatusCreated, body: `{"request":{"id":7}}`},
+		"POST /api/v2/tickets.json":  {status: http.StatusCreated, body: `{"ticket":{"id":7}}`},
+		"PUT /api/v2/tickets/7.json": {status: http.StatusOK, body: `{}`},
+	}
+
+	tests := []struct {
+		name   string
+		handle func(context.Context, *Config, *keptnv2.Keptn, cloudevents.Event) error
+		// ZENDESK_TICKET_FOR_DEPLOYMENTS, _TESTS and _RELEASES
+		enabled     bool
+		zendeskYAML string
+		wantCalls   []string
+		// Call whose body has the subject
+		wantCall    string
+		wantSubject string
+		// Call that sets the type of change records
+		typeCall string
+	}{
+		{name: "deployment disabled", handle: deployment(keptnv2.ResultFailed)},
+		{
+			name:        "failed deployment",
+			handle:      deployment(keptnv2.ResultFailed),
+			enabled:     true,
+			wantCalls:   sequenceTicket,
+			wantCall:    "POST /api/v2/requests.json",
+			wantSubject: "[DEPLOYMENT] sockshop - carts - production - Result: fail",
+		},
+		{name: "passed deployment", handle: deployment(keptnv2.ResultPass), enabled: true},
+		{
+			name:        "passed deployment wanted by zendesk.yaml",
+			handle:      deployment(keptnv2.ResultPass),
+			zendeskYAML: "version: v1\nevents:\n  deployment:\n    enabled: true\n    results: [pass]\n",
+			wantCalls:   sequenceTicket,
+			wantCall:    "POST /api/v2/requests.json",
+			wantSubject: "[DEPLOYMENT] sockshop - carts - production - Result: pass",
+		},
+		{
+			name:        "test with a warning",
+			handle:      test(keptnv2.ResultWarning),
+			enabled:     true,
+			wantCalls:   sequenceTicket,
+			wantCall:    "POST /api/v2/requests.json",
+			wantSubject: "[TEST] sockshop - carts - production - Result: warning",
+		},
+		{name: "passed test", handle: test(keptnv2.ResultPass), enabled: true},
+		{name: "test disabled by zendesk.yaml", handle: test(keptnv2.ResultFailed), enabled: true, zendeskYAML: "version: v1\nevents:\n  test:\n    enabled: false\n"},
+		{name: "release disabled", handle: release(keptnv2.ResultPass)},
+		{
+			name:        "every release is a change record",
+			handle:      release(keptnv2.ResultPass),
+			enabled:     true,
+			wantCalls:   []string{"POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+			wantCall:    "POST /api/v2/requests.json",
+			wantSubject: "[CHANGE] carts released to sockshop/production (a1b2c3) - Result: pass",
+			typeCall:    "PUT /api/v2/tickets/7.json",
+		},
+		{
+			name:        "change record through the Tickets API",
+			handle:      release(keptnv2.ResultFailed),
+			enabled:     true,
+			zendeskYAML: "version: v1\ndefaults:\n  api: tickets\n",
+			wantCalls:   []string{"POST /api/v2/tickets.json"},
+			wantCall:    "POST /api/v2/tickets.json",
+			wantSubject: "[CHANGE] carts released to sockshop/production (a1b2c3) - Result: fail",
+			typeCall:    "POST /api/v2/tickets.json",
+		},
+		{name: "release result not wanted by zendesk.yaml", handle: release(keptnv2.ResultFailed), enabled: true, zendeskYAML: "version: v1\nevents:\n  release:\n    results: [pass]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := map[string]string{}
+			if tt.zendeskYAML != "" {
+				resources[stageResource] = tt.zendeskYAML
+			}
+			myKeptn := testKeptnHandler(t, fakeConfigurationService(t, resources, 0).URL, sequence)
+			defer correlator.forget(myKeptn.KeptnContext)
+
+			zd := newFakeZendesk(t, responses)
+			cfg := fakeZendeskConfig(zd)
+			cfg.Zendesk.TicketForDeployments = tt.enabled
+			cfg.Zendesk.TicketForTests = tt.enabled
+			cfg.Zendesk.TicketForReleases = tt.enabled
+
+			if err := tt.handle(context.Background(), cfg, myKeptn, newTestEvent(t, "sh.keptn.event.test", sequence)); err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if calls := zd.called(); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if tt.wantCall == "" {
+				return
+			}
+			if created := zd.body(tt.wantCall); !strings.Contains(created, `"subject":"`+tt.wantSubject+`"`) {
+				t.Errorf("ticket = %s, want subject %q", created, tt.wantSubject)
+			}
+			if tt.typeCall == "" {
+				return
+			}
+			fields := zd.body(tt.typeCall)
+			if !strings.Contains(fields, `"type":"task"`) {
+				t.Errorf("%s = %s, want type task", tt.typeCall, fields)
+			}
+			if strings.Contains(fields, "external_id") {
+				t.Errorf("%s = %s, change records are not linked to the sequence", tt.typeCall, fields)
+			}
+		})
+	}
+}
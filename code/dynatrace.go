@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dynatraceHTTPClient = instrumentedHTTPClient(downstreamDynatrace, 30*time.Second)
+
+// Builds an entity selector for the services tagged with the standard keptn tags:
+// keptn_project, keptn_stage and keptn_service
+func createEntitySelector(project string, stage string, service string) string {
+	return fmt.Sprintf(`type("SERVICE"),tag("keptn_project:%s"),tag("keptn_stage:%s"),tag("keptn_service:%s")`,
+		escapeEntitySelectorValue(project), escapeEntitySelectorValue(stage), escapeEntitySelectorValue(service))
+}
+
+// Special characters in quoted entity selector values are escaped with a tilde
+func escapeEntitySelectorValue(value string) string {
+	return strings.NewReplacer("~", "~~", `"`, `~"`).Replace(value)
+}
+
+// Sends an event to the Dynatrace Events API v2 (DT_TENANT, DT_API_TOKEN)
+// The response tells how many entities matched the entity selector
+func sendDynatraceEvent(ctx context.Context, details DynatraceDetails, event DtEvent) (*DtEventIngestResponse, error) {
+	if details.Tenant == "" || details.APIToken == "" {
+		return nil, fmt.Errorf("DT_TENANT and DT_API_TOKEN must be set to send events to Dynatrace")
+	}
+
+	jsonString, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode Dynatrace event: %w", err)
+	}
+
+	dtTenantURL := "https://" + details.Tenant + "/api/v2/events/ingest"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dtTenantURL, bytes.NewReader(jsonString))
+	if err != nil {
+		return nil, fmt.Errorf("could not create Dynatrace request: %w", err)
+	}
+	req.Header.Add("accept", "application/json; charset=utf-8")
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", "Api-Token "+details.APIToken)
+
+	resp, err := dynatraceHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not send event to Dynatrace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Dynatrace response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Dynatrace returned %s: %s", resp.Status, string(body))
+	}
+
+	ingestResponse := &DtEventIngestResponse{}
+	if err := json.Unmarshal(body, ingestResponse); err != nil {
+		return nil, fmt.Errorf("could not decode Dynatrace response: %w", err)
+	}
+	return ingestResponse, nil
+}
+
+// Verifies that the DT_API_TOKEN is known, enabled and allowed to ingest events
+func checkDynatraceToken(ctx context.Context, details DynatraceDetails) error {
+	payload, err := json.Marshal(DtAPITokenLookup{Token: details.APIToken})
+	if err != nil {
+		return fmt.Errorf("could not encode Dynatrace token lookup: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+details.Tenant+"/api/v2/apiTokens/lookup", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create Dynatrace request: %w", err)
+	}
+	req.Header.Add("accept", "application/json; charset=utf-8")
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", "Api-Token "+details.APIToken)
+
+	resp, err := dynatraceHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach Dynatrace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read Dynatrace response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Dynatrace returned %s: %s", resp.Status, string(body))
+	}
+
+	token := DtAPIToken{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("could not decode Dynatrace response: %w", err)
+	}
+	if !token.Enabled {
+		return fmt.Errorf("DT_API_TOKEN %q is disabled", token.Name)
+	}
+	for _, scope := range token.Scopes {
+		if scope == DtScopeEventsIngest {
+			return nil
+		}
+	}
+	return fmt.Errorf("DT_API_TOKEN %q lacks the %s scope", token.Name, DtScopeEventsIngest)
+}
+
+// Logs whether the event (and with it the ticket link) was attached to any entity
+func logDynatraceIngestResponse(ctx context.Context, response *DtEventIngestResponse, ticketURL string) {
+	if response.ReportCount == 0 {
+		slog.WarnContext(ctx, "Dynatrace accepted the event but no entity matched the entity selector. The ticket is not linked to any service. Check the keptn_project, keptn_stage and keptn_service tags", "ticketURL", ticketURL)
+		return
+	}
+	for _, result := range response.EventIngestResults {
+		slog.InfoContext(ctx, "Sent Dynatrace event", "ticketURL", ticketURL, "correlationID", result.CorrelationID, "status", result.Status)
+	}
+}
+
+// dynatraceSink attaches the ticket link to the services tagged with keptn_project, keptn_stage and keptn_service
+// It uses the DynatraceDetails of the live configuration, so a rotated DT_API_TOKEN is picked up without a restart
+type dynatraceSink struct {
+	config *configSource
+}
+
+func newDynatraceSink(config *configSource) (Sink, error) {
+	if details := config.Load().Dynatrace; details.Tenant == "" || details.APIToken == "" {
+		return nil, fmt.Errorf("DT_TENANT and DT_API_TOKEN must be set")
+	}
+	return &dynatraceSink{config: config}, nil
+}
+
+func (s *dynatraceSink) Name() string {
+	return "dynatrace"
+}
+
+func (s *dynatraceSink) Check(ctx context.Context) error {
+	return checkDynatraceToken(ctx, s.config.Load().Dynatrace)
+}
+
+func (s *dynatraceSink) Send(ctx context.Context, notification Notification) error {
+	details := s.config.Load().Dynatrace
+	properties := map[string]string{}
+	for key, value := range notification.Properties {
+		properties[key] = value
+	}
+	properties["Source"] = ServiceName
+
+	dtEvent := DtEvent{
+		EventType:      details.EventType,
+		Title:          "Ticket Created: #" + strconv.FormatInt(notification.TicketID, 10),
+		EntitySelector: createEntitySelector(notification.Project, notification.Stage, notification.Service),
+		Properties:     properties,
+	}
+
+	response, err := sendDynatraceEvent(ctx, details, dtEvent)
+	if err != nil {
+		return err
+	}
+	logDynatraceIngestResponse(ctx, response, notification.TicketURL)
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDynatrace is a Dynatrace tenant answering every request with the same status and body
+type fakeDynatrace struct {
+	details DynatraceDetails
+
+	mu       sync.Mutex
+	requests []*http.Request
+	payloads []string
+}
+
+// Starts a fake Dynatrace tenant. Dynatrace is called through its client while the test runs
+func newFakeDynatrace(t *testing.T, status int, body string) *fakeDynatrace {
+	t.Helper()
+	f := &fakeDynatrace{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		f.mu.Lock()
+		f.requests = append(f.requests, r)
+		f.payloads = append(f.payloads, string(payload))
+		f.mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := dynatraceHTTPClient
+	dynatraceHTTPClient = server.Client()
+	t.Cleanup(func() { dynatraceHTTPClient = client })
+
+	f.details = DynatraceDetails{Tenant: server.Listener.Addr().String(), APIToken: "dt0c01.token", EventType: DtEventTypeAnnotation}
+	return f
+}
+
+// Returns the requests so far and their payloads
+func (f *fakeDynatrace) received() ([]*http.Request, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...), append([]string(nil), f.payloads...)
+}
+
+func TestCreateEntitySelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		stage   string
+		service string
+		want    string
+	}{
+		{
+			name:    "plain",
+			project: "sockshop",
+			stage:   "production",
+			service: "carts",
+			want:    `type("SERVICE"),tag("keptn_project:sockshop"),tag("keptn_stage:production"),tag("keptn_service:carts")`,
+		},
+		{
+			name:    "quotes and tildes are escaped",
+			project: `sock"shop`,
+			stage:   "prod~eu",
+			service: "carts",
+			want:    `type("SERVICE"),tag("keptn_project:sock~"shop"),tag("keptn_stage:prod~~eu"),tag("keptn_service:carts")`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createEntitySelector(tt.project, tt.stage, tt.service); got != tt.want {
+				t.Errorf("createEntitySelector() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDynatraceSinkSend(t *testing.T) {
+	notification := Notification{
+		TicketID:   42,
+		TicketURL:  "https://acme.zendesk.com/agent/tickets/42",
+		Project:    "sockshop",
+		Stage:      "production",
+		Service:    "carts",
+		Properties: map[string]string{"Ticket URL": "https://acme.zendesk.com/agent/tickets/42"},
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{name: "attached", status: http.StatusCreated, body: `{"reportCount":1,"eventIngestResults":[{"correlationId":"abc","status":"OK"}]}`},
+		{name: "no entity matched", status: http.StatusCreated, body: `{"reportCount":0}`},
+		{name: "rejected", status: http.StatusBadRequest, body: `{"error":{"message":"invalid entitySelector"}}`, wantErr: true},
+		{name: "unreadable response", status: http.StatusCreated, body: `<html>`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := newFakeDynatrace(t, tt.status, tt.body)
+			cfg := validConfig()
+			cfg.Dynatrace = dt.details
+			sink := &dynatraceSink{config: newConfigSource(cfg)}
+
+			if err := sink.Send(context.Background(), notification); (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			requests, payloads := dt.received()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			if requests[0].URL.Path != "/api/v2/events/ingest" || requests[0].Header.Get("Authorization") != "Api-Token dt0c01.token" {
+				t.Errorf("request = %s %s with Authorization %q", requests[0].Method, requests[0].URL.Path, requests[0].Header.Get("Authorization"))
+			}
+
+			event := DtEvent{}
+			if err := json.Unmarshal([]byte(payloads[0]), &event); err != nil {
+				t.Fatal(err)
+			}
+			want := DtEvent{
+				EventType:      DtEventTypeAnnotation,
+				Title:          "Ticket Created: #42",
+				EntitySelector: createEntitySelector("sockshop", "production", "carts"),
+				Properties:     map[string]string{"Ticket URL": notification.TicketURL, "Source": ServiceName},
+			}
+			if !reflect.DeepEqual(event, want) {
+				t.Errorf("payload = %+v, want %+v", event, want)
+			}
+		})
+	}
+}
+
+func TestCheckDynatraceToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "valid", status: http.StatusOK, body: `{"name":"keptn","enabled":true,"scopes":["metrics.read","events.ingest"]}`},
+		{name: "disabled", status: http.StatusOK, body: `{"name":"keptn","enabled":false,"scopes":["events.ingest"]}`, wantErr: "is disabled"},
+		{name: "missing scope", status: http.StatusOK, body: `{"name":"keptn","enabled":true,"scopes":["metrics.read"]}`, wantErr: "lacks the events.ingest scope"},
+		{name: "unknown token", status: http.StatusNotFound, body: `{"error":{"code":404}}`, wantErr: "404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := newFakeDynatrace(t, tt.status, tt.body)
+
+			err := checkDynatraceToken(context.Background(), dt.details)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkDynatraceToken() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkDynatraceToken() = %v, want %q", err, tt.wantErr)
+			}
+			if _, payloads := dt.received(); len(payloads) != 1 || payloads[0] != `{"token":"dt0c01.token"}` {
+				t.Errorf("lookup payloads = %v", payloads)
+			}
+		})
+	}
+}
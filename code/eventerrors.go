@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// eventError tells processKeptnCloudEvent how to answer an event the handlers could not process
+// Permanent errors (bad payloads, rejected tickets, broken templates) will fail again, so the event is dropped.
+// Transient errors (rate limits, Zendesk outages, timeouts) are answered so that the event is redelivered
+type eventError struct {
+	err       error
+	permanent bool
+}
+
+func (e *eventError) Error() string { return e.err.Error() }
+func (e *eventError) Unwrap() error { return e.err }
+
+func permanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &eventError{err: err, permanent: true}
+}
+
+func transientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &eventError{err: err}
+}
+
+// Classifies an error of the Zendesk client. Rate limits, 5xx, network errors and timeouts are transient
+func classifyZendeskError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if zendesk.IsTemporary(err) || errors.Is(err, context.DeadlineExceeded) {
+		return transientError(err)
+	}
+	return permanentError(err)
+}
+
+// isPermanent reports whether err is an eventError that must not be retried
+// Unclassified errors are treated as transient
+func isPermanent(err error) bool {
+	var eventErr *eventError
+	return errors.As(err, &eventErr) && eventErr.permanent
+}
+
+// eventCounters count how incoming events ended. They are logged with every failure
+type eventCounters struct {
+	received          uint64
+	handled           uint64
+	permanentFailures uint64
+	transientFailures uint64
+	duplicates        uint64
+}
+
+var eventStats eventCounters
+
+func (c *eventCounters) String() string {
+	return fmt.Sprintf("received=%d handled=%d permanent_failures=%d transient_failures=%d duplicates=%d",
+		atomic.LoadUint64(&c.received), atomic.LoadUint64(&c.handled),
+		atomic.LoadUint64(&c.permanentFailures), atomic.LoadUint64(&c.transientFailures),
+		atomic.LoadUint64(&c.duplicates))
+}
+
+// Maps the outcome of a handler onto the CloudEvents protocol result:
+// ACK (200) if the event was handled, NACK with 400 for permanent errors
+// and NACK with 503 for transient errors so that the sender retries
+func eventResult(ctx context.Context, event cloudevents.Event, err error) cloudevents.Result {
+	if err == nil {
+		atomic.AddUint64(&eventStats.handled, 1)
+		observeEventProcessed(event.Type(), eventOutcomeHandled)
+		return cloudevents.ResultACK
+	}
+
+	if isPermanent(err) {
+		atomic.AddUint64(&eventStats.permanentFailures, 1)
+		observeEventProcessed(event.Type(), eventOutcomePermanentFailure)
+		slog.ErrorContext(ctx, "Dropping event", "error", err, "stats", eventStats.String())
+		return cloudevents.NewHTTPResult(http.StatusBadRequest, "%v", err)
+	}
+
+	atomic.AddUint64(&eventStats.transientFailures, 1)
+	observeEventProcessed(event.Type(), eventOutcomeTransientFailure)
+	slog.WarnContext(ctx, "Could not handle event, asking for redelivery", "error", err, "stats", eventStats.String())
+	return cloudevents.NewHTTPResult(http.StatusServiceUnavailable, "%v", err)
+}
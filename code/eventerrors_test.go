@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+func TestClassifyZendeskError(t *testing.T) {
+	apiError := func(status int) error {
+		return &zendesk.APIError{StatusCode: status, Method: http.MethodPost, URL: "https://acme.zendesk.com/api/v2/requests.json"}
+	}
+
+	tests := []struct {
+		name          string
+		err           error
+		wantPermanent bool
+	}{
+		{name: "rate limit", err: apiError(http.StatusTooManyRequests)},
+		{name: "server error", err: apiError(http.StatusInternalServerError)},
+		{name: "unavailable", err: apiError(http.StatusServiceUnavailable)},
+		{name: "timeout", err: fmt.Errorf("create ticket: %w", context.DeadlineExceeded)},
+		{name: "bad request", err: apiError(http.StatusBadRequest), wantPermanent: true},
+		{name: "unauthorized", err: apiError(http.StatusUnauthorized), wantPermanent: true},
+		{name: "rejected ticket", err: apiError(http.StatusUnprocessableEntity), wantPermanent: true},
+		{name: "wrapped", err: fmt.Errorf("update ticket: %w", apiError(http.StatusNotFound)), wantPermanent: true},
+		{name: "unknown", err: errors.New("zendesk: invalid base URL"), wantPermanent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classified := classifyZendeskError(tt.err)
+			if isPermanent(classified) != tt.wantPermanent {
+				t.Errorf("isPermanent(classifyZendeskError(%v)) = %v, want %v", tt.err, !tt.wantPermanent, tt.wantPermanent)
+			}
+			if !errors.Is(classified, tt.err) {
+				t.Errorf("classifyZendeskError(%v) does not wrap the error", tt.err)
+			}
+		})
+	}
+
+	if classifyZendeskError(nil) != nil {
+		t.Error("classifyZendeskError(nil) != nil")
+	}
+}
+
+func TestEventResult(t *testing.T) {
+	event := cloudevents.NewEvent()
+	event.SetType("sh.keptn.event.evaluation.finished")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantACK    bool
+		wantStatus int
+	}{
+		{name: "handled", wantACK: true},
+		{name: "permanent", err: permanentError(errors.New("could not parse event data")), wantStatus: http.StatusBadRequest},
+		{name: "transient", err: transientError(errors.New("could not send zendesk.finished")), wantStatus: http.StatusServiceUnavailable},
+		{name: "unclassified errors are retried", err: errors.New("unexpected"), wantStatus: http.StatusServiceUnavailable},
+		{name: "wrapped permanent", err: fmt.Errorf("approval: %w", permanentError(errors.New("broken template"))), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := eventResult(context.Background(), event, tt.err)
+			if cloudevents.IsACK(result) != tt.wantACK {
+				t.Fatalf("eventResult() = %v, want ACK %v", result, tt.wantACK)
+			}
+			if tt.wantACK {
+				return
+			}
+			var httpResult *cehttp.Result
+			if !cloudevents.ResultAs(result, &httpResult) || httpResult.StatusCode != tt.wantStatus {
+				t.Errorf("eventResult() = %v, want status %d", result, tt.wantStatus)
+			}
+		})
+	}
+}
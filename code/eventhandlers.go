@@ -1,54 +1,115 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
 )
 
-func HandleEvaluationFinishedEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.EvaluationFinishedEventData) {
-	log.Println("[eventhandlers.go] Handling evaluation.finished Event:", incomingEvent.Context.GetID())
+func HandleEvaluationFinishedEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.EvaluationFinishedEventData) error {
+	slog.InfoContext(ctx, "Handling evaluation.finished event")
+
+	config := loadZendeskConfig(ctx, myKeptn)
+	settings := config.SettingsFor(keptnv2.EvaluationTaskName)
+
+	if !settings.IsEnabled(cfg.Zendesk.TicketForEvaluations) {
+		slog.InfoContext(ctx, "Tickets for evaluations are disabled (TicketForEvaluations flag or zendesk.yaml). Got an evaluation.finished from Keptn but doing nothing. If you want a ticket, enable them")
+		return nil
+	}
+
+	// A passing evaluation recovers the tickets of earlier failed evaluations of the same service
+	if data.Evaluation.Result == string(keptnv2.ResultPass) {
+		if err := resolveRecoveredTickets(ctx, cfg, myKeptn, data); err != nil {
+			slog.WarnContext(ctx, "Could not resolve recovered tickets", "error", err)
+		}
+	}
 
-	if !ZENDESK_DETAILS.TicketForEvaluations {
-		log.Println("[eventhandlers.go] TicketForEvaluations flag is set to false. Got an evaluation.finished from Keptn but doing nothing. If you want a ticket, set flag to true")
-		return
+	if !settings.MatchesResult(data.Evaluation.Result) {
+		slog.InfoContext(ctx, "zendesk.yaml does not want tickets for evaluation result", "result", data.Evaluation.Result)
+		return nil
 	}
 
-	ticketKey := createZendeskTicketForEvaluationFinished(myKeptn, data)
-	ticketURL := ZENDESK_DETAILS.BaseURL + "/agent/tickets/" + ticketKey
+	if rule := config.matchRule(evaluationRuleEvent(data)); rule != nil {
+		slog.InfoContext(ctx, "Ticket rule matched", "rule", rule.Name, "priority", rule.Set.Priority, "type", rule.Set.Type)
+		settings = rule.apply(settings)
+	}
 
-	// If the SEND_EVENT flag is set in service.yaml send an event to the relevant tool
-	SEND_EVENT, _ := strconv.ParseBool(os.Getenv("SEND_EVENT"))
-	if SEND_EVENT {
-		sendEventForEvaluationFinishedEvents("dynatrace", "CUSTOM_INFO", ticketURL, data, myKeptn)
+	ticketID, err := createZendeskTicketForEvaluationFinished(ctx, cfg, myKeptn, data, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+		return err
 	}
+	ticketURL := cfg.Zendesk.TicketURL(ticketID)
+
+	// Let the enabled sinks (SINKS) know about the ticket
+	notifySinks(ctx, Notification{
+		Kind:         keptnv2.EvaluationTaskName,
+		TicketID:     ticketID,
+		TicketURL:    ticketURL,
+		KeptnContext: myKeptn.KeptnContext,
+		EventID:      incomingEvent.ID(),
+		Project:      data.EventData.GetProject(),
+		Stage:        data.EventData.GetStage(),
+		Service:      data.EventData.GetService(),
+		Result:       data.Evaluation.Result,
+		Properties:   createCustomPropertiesForEvaluationFinishedEvents(cfg, myKeptn, data, ticketURL),
+	})
+	return nil
 }
 
-func HandleRemediationFinishedEvent(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.RemediationFinishedEventData) {
-	log.Printf("[eventhandlers.go] Handling remediation.finished event: %s", incomingEvent.Context.GetID())
+func HandleRemediationFinishedEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *keptnv2.RemediationFinishedEventData) error {
+	slog.InfoContext(ctx, "Handling remediation.finished event")
+
+	config := loadZendeskConfig(ctx, myKeptn)
+	settings := config.SettingsFor(keptnv2.RemediationTaskName)
 
-	if !ZENDESK_DETAILS.TicketForProblems {
-		log.Println("[eventhandlers.go] TicketForProblems flag is set to false. Got a remediation.finished from Keptn but doing nothing. If you want a ticket, set flag to true")
-		return
+	if !settings.IsEnabled(cfg.Zendesk.TicketForProblems) {
+		slog.InfoContext(ctx, "Tickets for problems are disabled (TicketForProblems flag or zendesk.yaml). Got a remediation.finished from Keptn but doing nothing. If you want a ticket, enable them")
+		return nil
 	}
 
-	ticketKey := createZendeskTicketForRemediationFinished(myKeptn, data)
-	ticketURL := ZENDESK_DETAILS.BaseURL + "/agent/tickets/" + ticketKey
+	if !settings.MatchesResult(string(data.Result)) {
+		slog.InfoContext(ctx, "zendesk.yaml does not want tickets for remediation result", "result", data.Result)
+		return nil
+	}
 
-	// If the SEND_EVENT flag is set in service.yaml send an event to the relevant tool
-	SEND_EVENT, _ := strconv.ParseBool(os.Getenv("SEND_EVENT"))
-	if SEND_EVENT {
-		sendEventForRemediationFinishedEvents("dynatrace", "CUSTOM_INFO", ticketURL, data, myKeptn)
+	if rule := config.matchRule(remediationRuleEvent(data)); rule != nil {
+		slog.InfoContext(ctx, "Ticket rule matched", "rule", rule.Name, "priority", rule.Set.Priority, "type", rule.Set.Type)
+		settings = rule.apply(settings)
 	}
+
+	ticketID, err := createZendeskTicketForRemediationFinished(ctx, cfg, myKeptn, data, settings)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+		return err
+	}
+	ticketURL := cfg.Zendesk.TicketURL(ticketID)
+
+	// Let the enabled sinks (SINKS) know about the ticket
+	notifySinks(ctx, Notification{
+		Kind:         keptnv2.RemediationTaskName,
+		TicketID:     ticketID,
+		TicketURL:    ticketURL,
+		KeptnContext: myKeptn.KeptnContext,
+		EventID:      incomingEvent.ID(),
+		Project:      data.EventData.GetProject(),
+		Stage:        data.EventData.GetStage(),
+		Service:      data.EventData.GetService(),
+		Result:       string(data.Result),
+		Properties:   createCustomPropertiesForRemediationFinishedEvents(cfg, myKeptn, data, ticketURL),
+	})
+	return nil
 }
 
 //*******************************
@@ -59,7 +120,7 @@ func HandleRemediationFinishedEvent(myKeptn *keptnv2.Keptn, incomingEvent cloude
 *   REMEDIATION.FINISHED SPECIFIC METHODS
 *********************************************/
 
-func createCustomPropertiesForRemediationFinishedEvents(myKeptn *keptnv2.Keptn, data *keptnv2.RemediationFinishedEventData, ticketURL string) map[string]string {
+func createCustomPropertiesForRemediationFinishedEvents(cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.RemediationFinishedEventData, ticketURL string) map[string]string {
 	var customProperties = make(map[string]string)
 
 	customProperties["Result"] = string(data.Result)
@@ -68,296 +129,324 @@ func createCustomPropertiesForRemediationFinishedEvents(myKeptn *keptnv2.Keptn,
 	customProperties["Keptn Stage"] = data.EventData.GetStage()
 	customProperties["Ticket"] = ticketURL
 	customProperties["SentBy"] = "Keptn"
-	bridgeURL := KEPTN_DETAILS.BridgeURL + "/project/" + data.EventData.GetProject() + "/sequence/" + myKeptn.KeptnContext
-	customProperties["BridgeURL"] = bridgeURL
+	customProperties["BridgeURL"] = cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	customProperties["Description"] = "Keptn Remediation Attempt"
 
 	return customProperties
 }
 
-// This function relies on standard keptn tags:
-// keptn_project, keptn_service and keptn_stage being present
-//
-// Note: This method might be replaced in future if we can send events that the dynatrace-service consumes
-// As the dynatrace-service contains nice helper methods to send events.
-func sendEventForRemediationFinishedEvents(eventDestination string, eventType string, ticketURL string, data *keptnv2.RemediationFinishedEventData, myKeptn *keptnv2.Keptn) {
-	log.Println("[eventhandlers.go] Sending event to:", eventDestination, " as type:", eventType)
-
-	// Split ticketURL by last forward slash to get the ticket Key
-	ticketKey := ticketURL[strings.LastIndex(ticketURL, "/")+1:]
-
-	// Send Dynatrace Event
-	if eventDestination == "dynatrace" && os.Getenv("DT_TENANT") != "" && os.Getenv("DT_API_TOKEN") != "" {
-
-		dynatraceTenant := os.Getenv("DT_TENANT")
-		dynatraceAPIToken := os.Getenv("DT_API_TOKEN")
-		dynatraceAPITokenHeader := "Api-Token " + dynatraceAPIToken
-
-		// Build data
-		var dtInfoEvent = new(DtInfoEvent)
-		dtInfoEvent.EventType = eventType
-		dtInfoEvent.Source = ServiceName
-		dtInfoEvent.Title = "Ticket Created: #" + ticketKey
-		dtInfoEvent.AttachRules = createAttachRulesForRemediationFinishedEvents(data)
-		dtInfoEvent.Description = "Keptn Remediation Attempt"
-		customProperties := createCustomPropertiesForRemediationFinishedEvents(myKeptn, data, ticketURL)
-		dtInfoEvent.CustomProperties = customProperties
-
-		//Encode the data
-		jsonString, _ := json.Marshal(dtInfoEvent)
-
-		client := &http.Client{}
-
-		dtTenantURL := "https://" + dynatraceTenant + "/api/v1/events"
-		req, _ := http.NewRequest("POST", dtTenantURL, bytes.NewReader(jsonString))
-		req.Header.Add("accept", "application/json")
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Authorization", dynatraceAPITokenHeader)
-
-		// Send Request
-		resp, err := client.Do(req)
-
-		//Handle Error
-		if err != nil {
-			log.Fatalf("[eventhandlers.go] An Error Occured Sending POSt to Zendesk %v", err)
-		}
-		defer resp.Body.Close()
+func createZendeskTicketForRemediationFinished(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.RemediationFinishedEventData, settings TicketSettings) (int64, error) {
 
-		//Read the response body
-		_, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Fatalln(err)
-		}
+	slog.DebugContext(ctx, "Creating Zendesk body details for remediation.finished")
+
+	// Render title and body (Zendesk ticket subject and html_body)
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, string(data.Result), data)
+	title, bodyContent, err := renderTicket(ctx, myKeptn, keptnv2.RemediationTaskName, settings.Template, templateData)
+	if err != nil {
+		// Broken templates fail again on redelivery
+		return 0, permanentError(err)
+	}
 
+	// Build map of labels which we take from the cloudevent, which we then attach to the Zendesk ticket
+	// plus the tags configured in zendesk.yaml
+	labels := append(createZendeskLabelsForRemediationFinishedEvents(data), settings.Tags...)
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      title,
+		Body:         bodyContent,
+		Labels:       labels,
+		// A successful remediation ends the problem, so its ticket can be solved
+		Status:   ticketStatusForResult(string(data.Result), true),
+		Priority: settings.Priority,
+		GroupID:  settings.GroupID,
+		Type:     settings.Type,
+		Agent:    settings.agentFields(),
 	}
 
+	// Create the ticket for this remediation sequence or add to the existing one
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
 }
 
-func createZendeskTicketForRemediationFinished(myKeptn *keptnv2.Keptn, data *keptnv2.RemediationFinishedEventData) string {
+func createZendeskLabelsForRemediationFinishedEvents(data *keptnv2.RemediationFinishedEventData) []string {
+	return createZendeskLabels(keptnv2.RemediationTaskName, data.EventData, string(data.Result))
+}
 
-	log.Println("[eventhandlers.go] Creating Zendesk Body details for remediation.finished...")
+/********************************************
+*   EVALUATION.FINISHED SPECIFIC METHODS
+*********************************************/
 
-	// Build title field
-	title := "[REMEDIATION] " + data.GetProject() + " - " + data.GetService() + " - " + data.GetStage() + " - Result: " + string(data.Result)
+func createCustomPropertiesForEvaluationFinishedEvents(cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.EvaluationFinishedEventData, ticketURL string) map[string]string {
+	var customProperties = make(map[string]string)
+	//customProperties = make(map[string]string)
 
-	// TODO - Zendesk doesn't accept Markdown by default. Reformat this...
-	bodyContent := "||*Remediation Status*||*Project*||*Service*||*Stage*||\n"
-	stringResult := string(data.Result)
-	result := ""
-	if stringResult == "pass" {
-		result += stringResult + " ✅"
-	} else if stringResult == "warning" {
-		result += stringResult + " ⚠"
-	} else if stringResult == "fail" {
-		result += stringResult + " ❌"
-	} else {
-		result += stringResult
-	}
-	bodyContent += "|" + result + "|" + data.GetProject() + "|" + data.GetService() + "|" + data.GetStage() + "|\n\n"
+	customProperties["Quality Gate Result"] = data.Evaluation.Result
+	customProperties["Quality Gate Score"] = fmt.Sprint(data.Evaluation.Score)
+	customProperties["Keptn Project"] = data.EventData.GetProject()
+	customProperties["Keptn Service"] = data.EventData.GetService()
+	customProperties["Keptn Stage"] = data.EventData.GetStage()
+	customProperties["Ticket"] = ticketURL
+	customProperties["SentBy"] = "Keptn"
+	customProperties["BridgeURL"] = cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	customProperties["Description"] = "Keptn Quality Gate Evaluation"
 
-	// Add Message
-	bodyContent += "Message: " + data.Message + "\n\n"
+	return customProperties
+}
+
+func createZendeskLabelsForEvaluationFinishedEvents(data *keptnv2.EvaluationFinishedEventData) []string {
+	return createZendeskLabels(keptnv2.EvaluationTaskName, data.EventData, data.Evaluation.Result)
+}
+
+func createZendeskTicketForEvaluationFinished(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.EvaluationFinishedEventData, settings TicketSettings) (int64, error) {
 
-	// Add Keptn Context
-	bodyContent += "Keptn Context ID: " + myKeptn.KeptnContext + "\n"
+	slog.DebugContext(ctx, "Creating Zendesk body details for evaluation.finished")
 
-	// Add link to Keptn Bridge
-	bridgeURL := KEPTN_DETAILS.BridgeURL + "/project/" + data.EventData.GetProject() + "/sequence/" + myKeptn.KeptnContext
-	bodyContent += "[Link To Keptn's Bridge|" + bridgeURL + "]"
+	// Render title and body (Zendesk ticket subject and html_body)
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, data.Evaluation.Result, data)
+	ticketTitle, bodyContent, err := renderTicket(ctx, myKeptn, keptnv2.EvaluationTaskName, settings.Template, templateData)
+	if err != nil {
+		// Broken templates fail again on redelivery
+		return 0, permanentError(err)
+	}
 
 	// Build map of labels which we take from the cloudevent, which we then attach to the Zendesk ticket
-	labels := createZendeskLabelsForRemediationFinishedEvents(data)
+	// plus the tags configured in zendesk.yaml
+	labels := append(createZendeskLabelsForEvaluationFinishedEvents(data), settings.Tags...)
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      ticketTitle,
+		Body:         bodyContent,
+		Labels:       labels,
+		Status:       ticketStatusForResult(data.Evaluation.Result, false),
+		Priority:     settings.Priority,
+		GroupID:      settings.GroupID,
+		Type:         settings.Type,
+		Agent:        settings.agentFields(),
+	}
 
-	// Send the POST to Zendesk
-	ticketKey := createZendeskTicket(title, bodyContent, labels)
-	return ticketKey
+	// Create the ticket for this sequence or add to the existing one
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
 }
 
-func createZendeskLabelsForRemediationFinishedEvents(data *keptnv2.RemediationFinishedEventData) []string {
-	//[]string{"foo:bar", "this:that"}
-	labels := []string{}
-
-	// Add Keptn Project, Service and Stage as labels
-	// Zendesk labels don't accept spaces so convert spaces to dashes
-	value := strings.ReplaceAll(data.EventData.GetProject(), " ", "-")
-	labels = append(labels, "keptn_project:"+value)
+/**************************************
+*         GENERIC METHODS
+***************************************/
+// zendeskTicket describes the ticket an event should create or update
+type zendeskTicket struct {
+	KeptnContext string
+	Subject      string
+	// Body is HTML, see templates.go
+	Body   string
+	Labels []string
+	// Status is only applied when updating an existing ticket
+	Status   string
+	Priority string
+	GroupID  int64
+	// Type is one of problem, incident, question or task
+	Type string
+	// Standalone tickets are never correlated with the other tickets of the sequence, e.g. change records
+	Standalone bool
+	Agent      agentTicketFields
+}
 
-	value = strings.ReplaceAll(data.EventData.GetService(), " ", "-")
-	labels = append(labels, "keptn_service:"+value)
+// agentTicketFields come from zendesk.yaml and need the agent Tickets API, see TicketSettings.agentFields
+type agentTicketFields struct {
+	// Create the ticket through the Tickets API instead of the Requests API
+	UseTicketsAPI bool
+	// Only set on new tickets, so that agents can reassign them
+	AssigneeID   int64
+	CustomFields []zendesk.CustomField
+	// Comments are internal notes
+	PrivateComments bool
+}
 
-	value = strings.ReplaceAll(data.EventData.GetStage(), " ", "-")
-	labels = append(labels, "keptn_service:"+value)
+// Shared Function between evaluations and remediation finished events to get a Zendesk ticket for a Keptn sequence
+// If the sequence (KeptnContext) already has a ticket, the body is added to it as a comment
+// and its tags and status are updated. Otherwise a new ticket is created
+// Returns the ID of the ticket. Errors are classified as transient or permanent, see classifyZendeskError
+func createOrUpdateZendeskTicket(ctx context.Context, cfg *Config, ticket zendeskTicket) (ticketID int64, err error) {
+	ctx, span := tracer.Start(ctx, "createOrUpdateZendeskTicket", trace.WithAttributes(keptnContextKey.String(ticket.KeptnContext)))
+	start := time.Now()
+	action := ticketActionCreated
+	defer func() {
+		if err != nil {
+			action = ticketActionFailed
+		}
+		observeTicket(ticket, action, start)
+		span.SetAttributes(zendeskTicketIDKey.Int64(ticketID), attribute.String("zendesk.action", action))
+		endSpan(span, err)
+	}()
 
-	// Add result as a label (pass, warning or fail)
-	labels = append(labels, "keptn_result:"+string(data.Result))
+	client, err := newZendeskClient(cfg.Zendesk)
+	if err != nil {
+		// Invalid ZENDESK_BASE_URL
+		return 0, permanentError(err)
+	}
 
-	for labelKey, labelValue := range data.Labels {
-		// Replace spaces with dashes for the Key and Value
-		labelKeyClean := strings.ReplaceAll(labelKey, " ", "-")
-		labelValueClean := strings.ReplaceAll(labelValue, " ", "-")
+	if !ticket.Standalone {
+		ticketID, err = correlator.find(ctx, client, ticket.KeptnContext)
+		if err != nil {
+			slog.WarnContext(ctx, "Could not look up an existing ticket for the Keptn context", "error", err)
+		}
+	}
 
-		//Stick the cleaned key and value back together
-		cleanKeyValueLabel := fmt.Sprint(labelKeyClean, ":", labelValueClean)
+	if ticketID != 0 {
+		err = updateZendeskTicket(ctx, client, ticketID, ticket)
+		if err == nil {
+			action = ticketActionUpdated
+			return ticketID, nil
+		}
+		// Closed or deleted tickets cannot be updated, so open a new one. Anything else, including a 403,
+		// would only lead to a duplicate ticket for the sequence
+		if !zendesk.IsNotFound(err) && !zendesk.IsUnprocessable(err) {
+			return 0, classifyZendeskError(err)
+		}
+		slog.InfoContext(ctx, "Ticket can no longer be updated. Creating a new one", "ticketID", ticketID, "error", err)
+		correlator.forget(ticket.KeptnContext)
+	}
 
-		labels = append(labels, cleanKeyValueLabel) // Append this "key":"value" using Sprint so as to not add spaces
+	ticketID, err = createZendeskTicket(ctx, client, ticket)
+	if err != nil {
+		return 0, classifyZendeskError(err)
 	}
+	correlator.link(ctx, client, ticketID, ticket)
 
-	return labels
+	return ticketID, nil
 }
 
-func createAttachRulesForRemediationFinishedEvents(data *keptnv2.RemediationFinishedEventData) DtAttachRules {
-	attachRule := DtAttachRules{
-		TagRule: []DtTagRule{
-			{
-				MeTypes: []string{"SERVICE"},
-				Tags: []DtTag{
-					{
-						Context: "CONTEXTLESS",
-						Key:     "keptn_project",
-						Value:   data.GetProject(),
-					},
-					{
-						Context: "CONTEXTLESS",
-						Key:     "keptn_stage",
-						Value:   data.GetStage(),
-					},
-					{
-						Context: "CONTEXTLESS",
-						Key:     "keptn_service",
-						Value:   data.GetService(),
-					},
-				},
-			},
-		},
-	}
-
-	return attachRule
-}
+// Creates a new ticket and returns its ID
+// The Requests API is used unless zendesk.yaml asks for the agent Tickets API, see createAgentTicket
+func createZendeskTicket(ctx context.Context, client *zendesk.Client, ticket zendeskTicket) (ticketID int64, err error) {
+	ctx, span := tracer.Start(ctx, "createZendeskTicket")
+	defer func() {
+		span.SetAttributes(zendeskTicketIDKey.Int64(ticketID))
+		endSpan(span, err)
+	}()
+
+	if ticket.Agent.UseTicketsAPI {
+		return createAgentTicket(ctx, client, ticket)
+	}
 
-/********************************************
-*   EVALUATION.FINISHED SPECIFIC METHODS
-*********************************************/
+	request := &zendesk.Request{
+		Subject: ticket.Subject,
+		Comment: &zendesk.Comment{HTMLBody: ticket.Body},
+		Tags:    ticket.Labels,
+	}
 
-// This function relies on standard keptn tags:
-// keptn_project, keptn_service and keptn_stage being present
-//
-// Note: This method might be replaced in future if we can send events that the dynatrace-service consumes
-// As the dynatrace-service contains nice helper methods to send events.
-func sendEventForEvaluationFinishedEvents(eventDestination string, eventType string, ticketURL string, data *keptnv2.EvaluationFinishedEventData, myKeptn *keptnv2.Keptn) {
-	log.Println("[eventhandlers.go] Sending event to:", eventDestination, " as type:", eventType)
-
-	// Split ticketURL by last forward slash to get the ticket Key
-	ticketKey := ticketURL[strings.LastIndex(ticketURL, "/")+1:]
-
-	// Send Dynatrace Event
-	if eventDestination == "dynatrace" && os.Getenv("DT_TENANT") != "" && os.Getenv("DT_API_TOKEN") != "" {
-
-		dynatraceTenant := os.Getenv("DT_TENANT")
-		dynatraceAPIToken := os.Getenv("DT_API_TOKEN")
-		dynatraceAPITokenHeader := "Api-Token " + dynatraceAPIToken
-
-		// Build data
-		var dtInfoEvent = new(DtInfoEvent)
-		dtInfoEvent.EventType = eventType
-		dtInfoEvent.Source = ServiceName
-		dtInfoEvent.Title = "Ticket Created: #" + ticketKey
-		dtInfoEvent.AttachRules = createAttachRulesForEvaluationFinishedEvents(data)
-		dtInfoEvent.Description = "Keptn Quality Gate Evaluation"
-		customProperties := createCustomPropertiesForEvaluationFinishedEvents(myKeptn, data, ticketURL)
-		dtInfoEvent.CustomProperties = customProperties
-
-		//Encode the data
-		jsonString, _ := json.Marshal(dtInfoEvent)
-
-		client := &http.Client{}
-
-		dtTenantURL := "https://" + dynatraceTenant + "/api/v1/events"
-		req, _ := http.NewRequest("POST", dtTenantURL, bytes.NewReader(jsonString))
-		req.Header.Add("accept", "application/json")
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Authorization", dynatraceAPITokenHeader)
-
-		// Send Request
-		resp, err := client.Do(req)
-
-		//Handle Error
-		if err != nil {
-			log.Fatalf("[eventhandlers.go] An Error Occured Sending POST to Zendesk %v", err)
-		}
-		defer resp.Body.Close()
+	created, err := client.CreateRequest(ctx, request)
+	if err != nil {
+		return 0, err
+	}
 
-		//Read the response body
-		_, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Fatalln(err)
-		}
+	slog.InfoContext(ctx, "Created Zendesk ticket", "ticketID", created.ID, "ticketURL", client.TicketURL(created.ID))
+	return created.ID, nil
+}
 
+// Creates a ticket with all its fields through the agent Tickets API, including the Keptn context as external_id
+func createAgentTicket(ctx context.Context, client *zendesk.Client, ticket zendeskTicket) (int64, error) {
+	create := &zendesk.Ticket{
+		Subject:      ticket.Subject,
+		Comment:      ticketComment(ticket),
+		Tags:         ticket.Labels,
+		Priority:     ticket.Priority,
+		Type:         ticket.Type,
+		GroupID:      ticket.GroupID,
+		AssigneeID:   ticket.Agent.AssigneeID,
+		CustomFields: ticket.Agent.CustomFields,
+	}
+	if !ticket.Standalone {
+		create.ExternalID = ticket.KeptnContext
 	}
 
+	created, err := client.CreateTicket(ctx, create)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.InfoContext(ctx, "Created Zendesk ticket through the Tickets API", "ticketID", created.ID, "ticketURL", client.TicketURL(created.ID))
+	return created.ID, nil
 }
 
-func createAttachRulesForEvaluationFinishedEvents(data *keptnv2.EvaluationFinishedEventData) DtAttachRules {
-	attachRule := DtAttachRules{
-		TagRule: []DtTagRule{
-			{
-				MeTypes: []string{"SERVICE"},
-				Tags: []DtTag{
-					{
-						Context: "CONTEXTLESS",
-						Key:     "keptn_project",
-						Value:   data.EventData.GetProject(),
-					},
-					{
-						Context: "CONTEXTLESS",
-						Key:     "keptn_stage",
-						Value:   data.EventData.GetStage(),
-					},
-					{
-						Context: "CONTEXTLESS",
-						Key:     "keptn_service",
-						Value:   data.EventData.GetService(),
-					},
-				},
-			},
-		},
-	}
-
-	return attachRule
+// The body as a comment, an internal note if zendesk.yaml says so
+func ticketComment(ticket zendeskTicket) *zendesk.Comment {
+	comment := &zendesk.Comment{HTMLBody: ticket.Body}
+	if ticket.Agent.PrivateComments {
+		public := false
+		comment.Public = &public
+	}
+	return comment
 }
 
-func createCustomPropertiesForEvaluationFinishedEvents(myKeptn *keptnv2.Keptn, data *keptnv2.EvaluationFinishedEventData, ticketURL string) map[string]string {
-	var customProperties = make(map[string]string)
-	//customProperties = make(map[string]string)
+// Adds the body as a comment to an existing ticket, merges the labels into its tags
+// and sets status, priority and group (if not empty)
+// End users may not use the agent Tickets API. When Zendesk refuses the update the comment is added through the Requests API,
+// which cannot change tags, priority or group and only knows the solved status, see updateZendeskRequest
+func updateZendeskTicket(ctx context.Context, client *zendesk.Client, ticketID int64, ticket zendeskTicket) (err error) {
+	ctx, span := tracer.Start(ctx, "updateZendeskTicket", trace.WithAttributes(zendeskTicketIDKey.Int64(ticketID)))
+	defer func() { endSpan(span, err) }()
+
+	update := &zendesk.Ticket{
+		Comment:        ticketComment(ticket),
+		AdditionalTags: ticket.Labels,
+		RemoveTags:     staleResultLabels(ticket.Labels),
+		Status:         ticket.Status,
+		Priority:       ticket.Priority,
+		GroupID:        ticket.GroupID,
+	}
 
-	customProperties["Quality Gate Result"] = data.Evaluation.Result
-	customProperties["Quality Gate Score"] = fmt.Sprint(data.Evaluation.Score)
-	customProperties["Keptn Project"] = data.EventData.GetProject()
-	customProperties["Keptn Service"] = data.EventData.GetService()
-	customProperties["Keptn Stage"] = data.EventData.GetStage()
-	customProperties["Ticket"] = ticketURL
-	customProperties["SentBy"] = "Keptn"
-	bridgeURL := KEPTN_DETAILS.BridgeURL + "/project/" + data.EventData.GetProject() + "/sequence/" + myKeptn.KeptnContext
-	customProperties["BridgeURL"] = bridgeURL
+	_, err = client.UpdateTicket(ctx, ticketID, update)
+	if zendesk.IsForbidden(err) && !ticket.Agent.UseTicketsAPI {
+		slog.InfoContext(ctx, "The Zendesk user may not update tickets. Updating them through the Requests API", "ticketID", ticketID)
+		return updateZendeskRequest(ctx, client, ticketID, ticket)
+	}
+	if err != nil {
+		return err
+	}
 
-	return customProperties
+	slog.InfoContext(ctx, "Updated Zendesk ticket", "ticketID", ticketID, "ticketURL", client.TicketURL(ticketID))
+	return nil
 }
 
-func createZendeskLabelsForEvaluationFinishedEvents(data *keptnv2.EvaluationFinishedEventData) []string {
+// Adds the body as a comment to an existing ticket through the Requests API and marks it as solved
+// if the status asks for it
+func updateZendeskRequest(ctx context.Context, client *zendesk.Client, ticketID int64, ticket zendeskTicket) error {
+	update := &zendesk.Request{
+		Comment: &zendesk.Comment{HTMLBody: ticket.Body},
+		Solved:  ticket.Status == zendesk.StatusSolved,
+	}
+	if _, err := client.UpdateRequest(ctx, ticketID, update); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Updated Zendesk ticket through the Requests API", "ticketID", ticketID, "ticketURL", client.TicketURL(ticketID))
+	return nil
+}
+
+// Builds the labels of a ticket from the cloudevent: Keptn project, service, stage, result and task
+// plus the labels of the event
+func createZendeskLabels(taskName string, data keptnv2.EventData, result string) []string {
 	//[]string{"foo:bar", "this:that"}
 	labels := []string{}
 
 	// Add Keptn Project, Service and Stage as labels
 	// Zendesk labels don't accept spaces so convert spaces to dashes
-	value := strings.ReplaceAll(data.EventData.GetProject(), " ", "-")
+	value := strings.ReplaceAll(data.GetProject(), " ", "-")
 	labels = append(labels, "keptn_project:"+value)
 
-	value = strings.ReplaceAll(data.EventData.GetService(), " ", "-")
+	value = strings.ReplaceAll(data.GetService(), " ", "-")
 	labels = append(labels, "keptn_service:"+value)
 
-	value = strings.ReplaceAll(data.EventData.GetStage(), " ", "-")
-	labels = append(labels, "keptn_service:"+value)
+	value = strings.ReplaceAll(data.GetStage(), " ", "-")
+	labels = append(labels, "keptn_stage:"+value)
+
+	// Add result as a label (pass, warning or fail). Triggered events have none
+	if result != "" {
+		labels = append(labels, "keptn_result:"+result)
+	}
 
-	// Add result as a label (pass, warning or fail)
-	labels = append(labels, "keptn_result:"+data.Evaluation.Result)
+	// Add the task (evaluation, deployment, ...) the ticket was opened for
+	labels = append(labels, taskLabelPrefix+taskName)
 
 	for labelKey, labelValue := range data.Labels {
 		// Replace spaces with dashes for the Key and Value
@@ -373,93 +462,113 @@ func createZendeskLabelsForEvaluationFinishedEvents(data *keptnv2.EvaluationFini
 	return labels
 }
 
-func createZendeskTicketForEvaluationFinished(myKeptn *keptnv2.Keptn, data *keptnv2.EvaluationFinishedEventData) string {
-
-	log.Println("[eventhandlers.go] Creating Zendesk Body details for evaluation.finished...")
-
-	// Build title field (Zendesk ticket title)
-	ticketTitle := "[EVALUATION] " + data.EventData.GetProject() + " - " + data.EventData.GetService() + " - " + data.EventData.GetStage() + " - Result: " + data.Evaluation.Result
+// Prefix of the label naming the Keptn task of a ticket, e.g. keptn_task:evaluation
+const taskLabelPrefix = "keptn_task:"
 
-	// Build description field (Zendesk ticket body)
-	// Build result table
-	// TODO - Zendesk doesn't accept Markdown by default. Reformat this...
-	bodyContent := "||*Result*||*Score*||\n"
-
-	result := ""
-	if data.Evaluation.Result == "pass" {
-		result += data.Evaluation.Result + " ✅"
-	} else if data.Evaluation.Result == "warning" {
-		result += data.Evaluation.Result + " ⚠"
-	} else if data.Evaluation.Result == "fail" {
-		result += data.Evaluation.Result + " ❌"
-	} else {
-		result += data.Evaluation.Result
+// Returns the keptn_result labels that no longer apply, given the labels of the latest event
+// A ticket should only ever carry the most recent result
+func staleResultLabels(labels []string) []string {
+	current := map[string]bool{}
+	for _, label := range labels {
+		current[label] = true
 	}
-	bodyContent += "|" + result + "|" + fmt.Sprint(data.Evaluation.Score) + "|" + "\n\n"
-
-	// Add Start Time and End Time
-	bodyContent += "Start Time: " + data.Evaluation.TimeStart + "\n"
-	bodyContent += "End Time: " + data.Evaluation.TimeEnd + "\n"
-
-	// Add Keptn Context
-	bodyContent += "Keptn Context ID: " + myKeptn.KeptnContext + "\n"
 
-	// Add link to Keptn Bridge
-	bridgeURL := KEPTN_DETAILS.BridgeURL + "/project/" + data.EventData.GetProject() + "/sequence/" + myKeptn.KeptnContext
-	bodyContent += "[Link To Keptn's Bridge|" + bridgeURL + "]"
-
-	// Build map of labels which we take from the cloudevent, which we then attach to the Zendesk ticket
-	labels := createZendeskLabelsForEvaluationFinishedEvents(data)
-
-	// Send the POST to Zendesk
-	ticketKey := createZendeskTicket(ticketTitle, bodyContent, labels)
-
-	return ticketKey
+	stale := []string{}
+	for _, result := range []keptnv2.ResultType{keptnv2.ResultPass, keptnv2.ResultWarning, keptnv2.ResultFailed} {
+		label := "keptn_result:" + string(result)
+		if !current[label] {
+			stale = append(stale, label)
+		}
+	}
+	return stale
 }
 
-/**************************************
-*         GENERIC METHODS
-***************************************/
-// Shared Function between evaluations and remediation finished events to create a Zendesk ticket
-// By this point, summary and description are correctly formulated
-// Depending on the type of ticket so this function can be shared
-// As it just sends the POST to Zendesk
-func createZendeskTicket(ticketTitle string, bodyContent string, labels []string) string {
-
-	url := ZENDESK_DETAILS.BaseURL + "/api/v2/requests.json"
-	jsonString, _ := json.Marshal(bodyContent)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(jsonString))
-
-	if err != nil {
-		log.Println("[eventhandlers.go] Got an error message creating request: ", err)
+// Returns the ticket status an update for the given result should set
+// Failures (re)open the ticket, anything else leaves the status alone unless solveOnPass is set
+func ticketStatusForResult(result string, solveOnPass bool) string {
+	switch keptnv2.ResultType(result) {
+	case keptnv2.ResultFailed, keptnv2.ResultWarning:
+		return zendesk.StatusOpen
+	case keptnv2.ResultPass:
+		if solveOnPass {
+			return zendesk.StatusSolved
+		}
 	}
+	return ""
+}
 
-	username := ZENDESK_DETAILS.EndUserEmail + "/token"
-	password := ZENDESK_DETAILS.APIToken
-	req.SetBasicAuth(username, password)
-	req.Header.Add("Content-Type", "application/json")
-	req.Close = true
+// The Zendesk client of the live configuration is shared between events so that its retry budget and
+// the rate limit headroom reported by Zendesk are tracked across the whole service.
+// It is replaced by swapZendeskClient when the configuration is reloaded
+var zendeskClientCache struct {
+	sync.Mutex
+	details ZendeskDetails
+	client  *zendesk.Client
+}
 
-	client := http.Client{}
+// Returns the shared Zendesk API client for the given details. Events that started before a reload
+// get a client of their own, so that they do not swap the shared client back to the old details
+func newZendeskClient(details ZendeskDetails) (*zendesk.Client, error) {
+	zendeskClientCache.Lock()
+	defer zendeskClientCache.Unlock()
 
-	// Send POST
-	response, err := client.Do(req)
+	if zendeskClientCache.client != nil && zendeskClientCache.details == details {
+		return zendeskClientCache.client, nil
+	}
+	client, err := buildZendeskClient(details)
 	if err != nil {
-		log.Println("[eventhandlers.go] Got an error sending request", err)
+		return nil, err
 	}
-
-	if response.StatusCode != http.StatusOK {
-		log.Println("[eventhandlers.go] Got a non OK status code. Status is: ", response.Status)
+	if zendeskClientCache.client == nil {
+		zendeskClientCache.details = details
+		zendeskClientCache.client = client
 	}
+	return client, nil
+}
 
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
+// Makes a client for details the shared one, see newZendeskClient
+func swapZendeskClient(details ZendeskDetails) error {
+	client, err := buildZendeskClient(details)
 	if err != nil {
-		log.Println("[eventhandlers.go] Got an error reading response body:", err)
-	} else {
-		log.Println("[eventhandlers.go] Response Body: ", body)
+		return err
 	}
 
-	return ""
+	zendeskClientCache.Lock()
+	defer zendeskClientCache.Unlock()
+	zendeskClientCache.details = details
+	zendeskClientCache.client = client
+	return nil
+}
+
+// The authentication strategy of ZENDESK_AUTH_METHOD. Token requests of client_credentials go through httpClient
+func zendeskAuthenticator(details ZendeskDetails, httpClient *http.Client) zendesk.Authenticator {
+	switch details.AuthMethod {
+	case zendeskAuthBearer:
+		return zendesk.BearerTokenAuth(details.OAuthAccessToken)
+	case zendeskAuthClientCredentials:
+		return zendesk.ClientCredentialsAuth(zendesk.ClientCredentials{
+			TokenURL:     details.OAuthTokenURL,
+			ClientID:     details.OAuthClientID,
+			ClientSecret: details.OAuthClientSecret,
+			Scope:        details.OAuthScope,
+		}, httpClient)
+	default:
+		return zendesk.APITokenAuth(details.EndUserEmail, details.APIToken)
+	}
+}
 
+func buildZendeskClient(details ZendeskDetails) (*zendesk.Client, error) {
+	retryPolicy := zendesk.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = details.MaxRetries + 1
+
+	httpClient := instrumentedHTTPClient(downstreamZendesk, 30*time.Second)
+	return zendesk.NewClient(details.BaseURL, zendeskAuthenticator(details, httpClient),
+		zendesk.WithUserAgent(ServiceName),
+		zendesk.WithHTTPClient(httpClient),
+		zendesk.WithRetryPolicy(retryPolicy),
+		zendesk.WithRetryNotify(func(ctx context.Context, info zendesk.RetryInfo) {
+			zendeskRetries.WithLabelValues(info.Method).Inc()
+			slog.WarnContext(ctx, "Zendesk call failed, retrying", "method", info.Method, "path", info.Path, "attempt", info.Attempt, "wait", info.Wait.String(), "error", info.Err)
+		}),
+	)
 }
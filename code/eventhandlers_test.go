@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// fakeZendesk answers Zendesk API calls with canned responses by "METHOD path" and records the calls
+// Calls without a response get a 404
+type fakeZendesk struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]fakeResponse
+	calls     []string
+	bodies    map[string]string
+}
+
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+func newFakeZendesk(t *testing.T, responses map[string]fakeResponse) *fakeZendesk {
+	t.Helper()
+	f := &fakeZendesk{responses: responses, bodies: map[string]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		call := r.Method + " " + r.URL.Path
+
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		f.bodies[call] = string(body)
+		response, ok := f.responses[call]
+		f.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			response = fakeResponse{status: http.StatusNotFound, body: `{"error":"RecordNotFound"}`}
+		}
+		w.WriteHeader(response.status)
+		w.Write([]byte(response.body))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Returns the calls so far, nil if there were none
+func (f *fakeZendesk) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeZendesk) body(call string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bodies[call]
+}
+
+// A configuration calling the fake Zendesk without retries
+func fakeZendeskConfig(f *fakeZendesk) *Config {
+	cfg := validConfig()
+	cfg.Zendesk.BaseURL = f.URL
+	return cfg
+}
+
+func TestCreateOrUpdateZendeskTicket(t *testing.T) {
+	created := fakeResponse{status: http.StatusCreated, body: `{"request":{"id":7}}`}
+	ok := fakeResponse{status: http.StatusOK, body: `{}`}
+
+	tests := []struct {
+		name string
+		// Ticket of the Keptn context in the local cache
+		cached     int64
+		agent      agentTicketFields
+		status     string
+		responses  map[string]fakeResponse
+		wantID     int64
+		wantErr    bool
+		wantCalls  []string
+		wantSolved bool
+	}{
+		{
+			name:      "new sequence",
+			responses: map[string]fakeResponse{"GET /api/v2/tickets.json": {status: http.StatusOK, body: `{"tickets":[]}`}, "POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			wantID:    7,
+			wantCalls: []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+		},
+		{
+			name: "ticket found by external_id",
+			responses: map[string]fakeResponse{
+				"GET /api/v2/tickets.json":   {status: http.StatusOK, body: `{"tickets":[{"id":9,"status":"closed"},{"id":8,"status":"open"},{"id":6,"status":"solved"}]}`},
+				"PUT /api/v2/tickets/8.json": ok,
+			},
+			wantID:    8,
+			wantCalls: []string{"GET /api/v2/tickets.json", "PUT /api/v2/tickets/8.json"},
+		},
+		{
+			name:      "lookup forbidden",
+			responses: map[string]fakeResponse{"GET /api/v2/tickets.json": {status: http.StatusForbidden}, "POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			wantID:    7,
+			wantCalls: []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+		},
+		{
+			name:      "cached ticket is updated",
+			cached:    42,
+			responses: map[string]fakeResponse{"PUT /api/v2/tickets/42.json": ok},
+			wantID:    42,
+			wantCalls: []string{"PUT /api/v2/tickets/42.json"},
+		},
+		{
+			name:      "end user updates through the Requests API",
+			cached:    42,
+			responses: map[string]fakeResponse{"PUT /api/v2/tickets/42.json": {status: http.StatusForbidden}, "PUT /api/v2/requests/42.json": ok},
+			wantID:    42,
+			wantCalls: []string{"PUT /api/v2/tickets/42.json", "PUT /api/v2/requests/42.json"},
+		},
+		{
+			name:       "end user solves through the Requests API",
+			cached:     42,
+			status:     "solved",
+			responses:  map[string]fakeResponse{"PUT /api/v2/tickets/42.json": {status: http.StatusForbidden}, "PUT /api/v2/requests/42.json": ok},
+			wantID:     42,
+			wantCalls:  []string{"PUT /api/v2/tickets/42.json", "PUT /api/v2/requests/42.json"},
+			wantSolved: true,
+		},
+		{
+			name:      "forbidden update with the Tickets API opens no duplicate",
+			cached:    42,
+			agent:     agentTicketFields{UseTicketsAPI: true},
+			responses: map[string]fakeResponse{"PUT /api/v2/tickets/42.json": {status: http.StatusForbidden}},
+			wantErr:   true,
+			wantCalls: []string{"PUT /api/v2/tickets/42.json"},
+		},
+		{
+			name:      "forbidden request update opens no duplicate",
+			cached:    42,
+			responses: map[string]fakeResponse{"PUT /api/v2/tickets/42.json": {status: http.StatusForbidden}, "PUT /api/v2/requests/42.json": {status: http.StatusForbidden}},
+			wantErr:   true,
+			wantCalls: []string{"PUT /api/v2/tickets/42.json", "PUT /api/v2/requests/42.json"},
+		},
+		{
+			name:      "closed ticket is replaced",
+			cached:    42,
+			responses: map[string]fakeResponse{"PUT /api/v2/tickets/42.json": {status: http.StatusUnprocessableEntity}, "POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			wantID:    7,
+			wantCalls: []string{"PUT /api/v2/tickets/42.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+		},
+		{
+			name:      "deleted ticket is replaced",
+			cached:    42,
+			responses: map[string]fakeResponse{"POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			wantID:    7,
+			wantCalls: []string{"PUT /api/v2/tickets/42.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := newFakeZendesk(t, tt.responses)
+			keptnContext := "ctx-" + tt.name
+			if tt.cached != 0 {
+				correlator.remember(keptnContext, tt.cached)
+			}
+			defer correlator.forget(keptnContext)
+
+			ticket := zendeskTicket{KeptnContext: keptnContext, Subject: "subject", Body: "<p>body</p>", Status: tt.status, Agent: tt.agent}
+			ticketID, err := createOrUpdateZendeskTicket(context.Background(), fakeZendeskConfig(zd), ticket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createOrUpdateZendeskTicket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ticketID != tt.wantID {
+				t.Errorf("ticket ID = %d, want %d", ticketID, tt.wantID)
+			}
+			if calls := zd.called(); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if update := zd.body("PUT /api/v2/requests/42.json"); strings.Contains(update, `"solved":true`) != tt.wantSolved {
+				t.Errorf("request update = %s, want solved %v", update, tt.wantSolved)
+			}
+			if !tt.wantErr {
+				if cached, _ := correlator.find(context.Background(), nil, keptnContext); cached != tt.wantID {
+					t.Errorf("cached ticket = %d, want %d", cached, tt.wantID)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAgentTicket(t *testing.T) {
+	agent := agentTicketFields{
+		UseTicketsAPI: true,
+		AssigneeID:    360007654321,
+		CustomFields:  []zendesk.CustomField{{ID: 1, Value: "checkout"}},
+	}
+	private := agent
+	private.PrivateComments = true
+
+	tests := []struct {
+		name       string
+		agent      agentTicketFields
+		standalone bool
+		// Substrings of the created ticket, and substrings it must not have
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "ticket of the sequence",
+			agent:   agent,
+			want:    []string{`"external_id":"ctx-agent"`, `"type":"incident"`, `"priority":"high"`, `"group_id":42`, `"assignee_id":360007654321`, `"custom_fields":[{"id":1,"value":"checkout"}]`},
+			notWant: []string{`"public"`},
+		},
+		{
+			name:       "change record",
+			agent:      agent,
+			standalone: true,
+			want:       []string{`"assignee_id":360007654321`},
+			notWant:    []string{"external_id"},
+		},
+		{name: "internal note", agent: private, want: []string{`"comment":{"html_body":"\u003cp\u003ebody\u003c/p\u003e","public":false}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := newFakeZendesk(t, map[string]fakeResponse{
+				"GET /api/v2/tickets.json":  {status: http.StatusOK, body: `{"tickets":[]}`},
+				"POST /api/v2/tickets.json": {status: http.StatusCreated, body: `{"ticket":{"id":7}}`},
+			})
+			defer correlator.forget("ctx-agent")
+
+			ticket := zendeskTicket{
+				KeptnContext: "ctx-agent",
+				Subject:      "subject",
+				Body:         "<p>body</p>",
+				Priority:     "high",
+				GroupID:      42,
+				Type:         "incident",
+				Agent:        tt.agent,
+				Standalone:   tt.standalone,
+			}
+			ticketID, err := createOrUpdateZendeskTicket(context.Background(), fakeZendeskConfig(zd), ticket)
+			if err != nil || ticketID != 7 {
+				t.Fatalf("createOrUpdateZendeskTicket() = %d, %v, want 7", ticketID, err)
+			}
+			// All fields are set at once, no second call to correlate the ticket
+			if calls := zd.called(); calls[len(calls)-1] != "POST /api/v2/tickets.json" {
+				t.Errorf("calls = %v, want the ticket creation last", calls)
+			}
+
+			created := zd.body("POST /api/v2/tickets.json")
+			for _, want := range tt.want {
+				if !strings.Contains(created, want) {
+					t.Errorf("ticket = %s, want %s", created, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(created, notWant) {
+					t.Errorf("ticket = %s, must not have %s", created, notWant)
+				}
+			}
+			correlator.mu.Lock()
+			_, cached := correlator.tickets["ctx-agent"]
+			correlator.mu.Unlock()
+			if cached == tt.standalone {
+				t.Errorf("ticket cached = %v, want %v", cached, !tt.standalone)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// Names of the readiness checks. Sinks are checked as "sink <name>"
+const (
+	checkConfig  = "config"
+	checkZendesk = "zendesk"
+)
+
+// A single check must not hold up the others for longer than this
+const healthCheckTimeout = 10 * time.Second
+
+// checkResult is the outcome of a readiness check as reported by /readyz
+type checkResult struct {
+	OK bool `json:"ok"`
+	// Degraded marks a failed check that does not fail readiness
+	Degraded  bool      `json:"degraded,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// healthChecker runs the readiness checks in the background and caches their results,
+// so that probes answer immediately and Zendesk and Dynatrace see one credential check per HEALTH_CHECK_INTERVAL
+type healthChecker struct {
+	config   *configSource
+	interval time.Duration
+	// A Zendesk outage would take every replica out of the service at once, so by default it only degrades
+	requireZendesk bool
+
+	mu      sync.RWMutex
+	results map[string]checkResult
+}
+
+func newHealthChecker(config *configSource, interval time.Duration, requireZendesk bool) *healthChecker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &healthChecker{config: config, interval: interval, requireZendesk: requireZendesk}
+}
+
+// Runs the checks right away and then every interval until ctx is done
+func (h *healthChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs all checks and replaces the cached results. Changes of a check are logged
+func (h *healthChecker) refresh(ctx context.Context) {
+	results := map[string]checkResult{}
+	check := func(name string, required bool, fn func(context.Context) error) {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		result := checkResult{OK: true, CheckedAt: time.Now().UTC()}
+		if err := fn(checkCtx); err != nil {
+			result.OK = false
+			result.Degraded = !required
+			result.Error = err.Error()
+		}
+		results[name] = result
+	}
+
+	cfg := h.config.Load()
+	check(checkConfig, true, func(context.Context) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		// The live configuration is still the previous one, but the files are broken
+		return h.config.reloadError()
+	})
+	// Without a valid configuration the credentials cannot be checked
+	if cfg.validate() == nil {
+		check(checkZendesk, h.requireZendesk, func(ctx context.Context) error { return checkZendeskCredentials(ctx, cfg.Zendesk) })
+	}
+	for _, sink := range notificationSinks {
+		if checker, ok := sink.sink.(sinkChecker); ok {
+			check("sink "+sink.sink.Name(), true, checker.Check)
+		}
+	}
+
+	h.mu.Lock()
+	previous := h.results
+	h.results = results
+	h.mu.Unlock()
+
+	for name, result := range results {
+		before, known := previous[name]
+		switch {
+		case !result.OK && (!known || before.OK):
+			slog.Warn("Readiness check failed", "check", name, "degraded", result.Degraded, "error", result.Error)
+		case result.OK && known && !before.OK:
+			slog.Info("Readiness check passed again", "check", name)
+		}
+	}
+}
+
+// Returns whether all required checks passed, whether others failed, and the results. Not ready until the first checks ran
+func (h *healthChecker) ready() (bool, bool, map[string]checkResult) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ready := len(h.results) > 0
+	degraded := false
+	results := make(map[string]checkResult, len(h.results))
+	for name, result := range h.results {
+		results[name] = result
+		ready = ready && (result.OK || result.Degraded)
+		degraded = degraded || result.Degraded
+	}
+	return ready, degraded, results
+}
+
+// Readiness probe: 200 if all required checks passed, 503 otherwise. The body lists the checks, e.g.
+//
+//	{"ready":true,"degraded":true,"checks":{"config":{"ok":true,...},"zendesk":{"ok":false,"degraded":true,"error":"zendesk: 503 Service Unavailable ...",...}}}
+func (h *healthChecker) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, degraded, results := h.ready()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Ready    bool                   `json:"ready"`
+		Degraded bool                   `json:"degraded"`
+		Checks   map[string]checkResult `json:"checks"`
+	}{ready, degraded, results})
+}
+
+// Liveness probe: the service is alive as long as it answers
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// Verifies that Zendesk accepts the credentials of ZENDESK_AUTH_METHOD
+func checkZendeskCredentials(ctx context.Context, details ZendeskDetails) error {
+	client, err := newZendeskClient(details)
+	if err != nil {
+		return err
+	}
+	user, err := client.CurrentUser(ctx)
+	if err != nil {
+		return err
+	}
+	// Zendesk answers unauthenticated requests with the anonymous user
+	if user == nil || user.ID == 0 {
+		if details.AuthMethod == zendeskAuthToken {
+			return fmt.Errorf("Zendesk did not accept the API token of %s", details.EndUserEmail)
+		}
+		return fmt.Errorf("Zendesk did not accept the %s credentials", details.AuthMethod)
+	}
+	// Recovered tickets are searched and updated through the agent Tickets API
+	if user.Role == zendesk.RoleEndUser && details.RecoveryPolicy != recoveryPolicyLeave {
+		return fmt.Errorf("ZENDESK_RECOVERY_POLICY %s needs an agent, but the Zendesk user is an end user. Set it to %s or use agent credentials",
+			details.RecoveryPolicy, recoveryPolicyLeave)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheckerReadyz(t *testing.T) {
+	passed := checkResult{OK: true}
+	failed := checkResult{Error: "zendesk: 401 Unauthorized"}
+	degraded := checkResult{Degraded: true, Error: "dial tcp: connection refused"}
+
+	tests := []struct {
+		name         string
+		results      map[string]checkResult
+		wantStatus   int
+		wantDegraded bool
+	}{
+		{name: "not checked yet", wantStatus: http.StatusServiceUnavailable},
+		{name: "all passed", results: map[string]checkResult{checkConfig: passed, checkZendesk: passed}, wantStatus: http.StatusOK},
+		{name: "zendesk degraded", results: map[string]checkResult{checkConfig: passed, checkZendesk: degraded}, wantStatus: http.StatusOK, wantDegraded: true},
+		{name: "zendesk required", results: map[string]checkResult{checkConfig: passed, checkZendesk: failed}, wantStatus: http.StatusServiceUnavailable},
+		{name: "config failed", results: map[string]checkResult{checkConfig: failed, checkZendesk: degraded}, wantStatus: http.StatusServiceUnavailable, wantDegraded: true},
+		{name: "sink failed", results: map[string]checkResult{checkConfig: passed, "sink dynatrace": failed}, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &healthChecker{results: tt.results}
+			recorder := httptest.NewRecorder()
+			h.serveReadyz(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			body := struct {
+				Ready    bool                   `json:"ready"`
+				Degraded bool                   `json:"degraded"`
+				Checks   map[string]checkResult `json:"checks"`
+			}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Ready != (tt.wantStatus == http.StatusOK) || body.Degraded != tt.wantDegraded {
+				t.Errorf("body = %s, want ready %v, degraded %v", recorder.Body, tt.wantStatus == http.StatusOK, tt.wantDegraded)
+			}
+			if len(body.Checks) != len(tt.results) {
+				t.Errorf("body lists %d checks, want %d", len(body.Checks), len(tt.results))
+			}
+		})
+	}
+}
+
+func TestCheckZendeskCredentials(t *testing.T) {
+	me := func(body string) map[string]fakeResponse {
+		return map[string]fakeResponse{"GET /api/v2/users/me.json": {status: http.StatusOK, body: body}}
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(details *ZendeskDetails)
+		responses map[string]fakeResponse
+		wantErr   string
+	}{
+		{name: "agent", responses: me(`{"user":{"id":1,"role":"agent"}}`)},
+		{name: "anonymous", responses: me(`{"user":{"id":null,"role":"end-user"}}`), wantErr: "did not accept the API token of jane@example.com"},
+		{
+			name: "anonymous with bearer token",
+			modify: func(details *ZendeskDetails) {
+				details.AuthMethod, details.OAuthAccessToken = zendeskAuthBearer, "access-token"
+			},
+			responses: me(`{"user":{"id":null}}`),
+			wantErr:   "did not accept the bearer credentials",
+		},
+		{name: "end user cannot recover tickets", responses: me(`{"user":{"id":2,"role":"end-user"}}`), wantErr: "ZENDESK_RECOVERY_POLICY solve needs an agent"},
+		{
+			name:      "end user leaving recovered tickets",
+			modify:    func(details *ZendeskDetails) { details.RecoveryPolicy = recoveryPolicyLeave },
+			responses: me(`{"user":{"id":2,"role":"end-user"}}`),
+		},
+		{name: "zendesk fails", responses: map[string]fakeResponse{"GET /api/v2/users/me.json": {status: http.StatusServiceUnavailable}}, wantErr: "503"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := fakeZendeskConfig(newFakeZendesk(t, tt.responses)).Zendesk
+			if tt.modify != nil {
+				tt.modify(&details)
+			}
+
+			err := checkZendeskCredentials(context.Background(), details)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkZendeskCredentials() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkZendeskCredentials() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerRefresh(t *testing.T) {
+	sinks := notificationSinks
+	notificationSinks = nil
+	defer func() { notificationSinks = sinks }()
+
+	agent := map[string]fakeResponse{"GET /api/v2/users/me.json": {status: http.StatusOK, body: `{"user":{"id":1,"role":"agent"}}`}}
+	down := map[string]fakeResponse{"GET /api/v2/users/me.json": {status: http.StatusServiceUnavailable}}
+
+	tests := []struct {
+		name           string
+		responses      map[string]fakeResponse
+		requireZendesk bool
+		invalid        bool
+		wantChecks     []string
+		wantReady      bool
+		wantDegraded   bool
+	}{
+		{name: "all passed", responses: agent, wantChecks: []string{checkConfig, checkZendesk}, wantReady: true},
+		{name: "zendesk down", responses: down, wantChecks: []string{checkConfig, checkZendesk}, wantReady: true, wantDegraded: true},
+		{name: "zendesk down and required", responses: down, requireZendesk: true, wantChecks: []string{checkConfig, checkZendesk}},
+		{name: "invalid configuration skips zendesk", responses: agent, invalid: true, wantChecks: []string{checkConfig}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := newFakeZendesk(t, tt.responses)
+			cfg := fakeZendeskConfig(zd)
+			if tt.invalid {
+				cfg.Zendesk.APIToken = ""
+			}
+			h := newHealthChecker(newConfigSource(cfg), 0, tt.requireZendesk)
+			h.refresh(context.Background())
+
+			ready, degraded, results := h.ready()
+			checks := []string{}
+			for name := range results {
+				checks = append(checks, name)
+			}
+			sort.Strings(checks)
+			if !reflect.DeepEqual(checks, tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", checks, tt.wantChecks)
+			}
+			if ready != tt.wantReady || degraded != tt.wantDegraded {
+				t.Errorf("ready() = %v, degraded %v, want %v, degraded %v (%+v)", ready, degraded, tt.wantReady, tt.wantDegraded, results)
+			}
+		})
+	}
+}
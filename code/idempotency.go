@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+)
+
+// Backends of the idempotency store (IDEMPOTENCY_BACKEND)
+const (
+	idempotencyBackendMemory = "memory"
+	idempotencyBackendFile   = "file"
+	idempotencyBackendNone   = "none"
+)
+
+// idempotencyStore remembers which events were handled already, so that redelivered events
+// don't open duplicate tickets. Keys expire after a TTL
+type idempotencyStore interface {
+	// Claim records key and reports false if key is already recorded and not yet expired
+	Claim(key string) (bool, error)
+	// Release forgets key, e.g. because handling the event failed and a redelivery should be processed
+	Release(key string) error
+}
+
+// The idempotency store, nil if disabled
+var processedEvents idempotencyStore
+
+func newIdempotencyStore(backend string, ttl time.Duration, maxKeys int, file string) (idempotencyStore, error) {
+	switch backend {
+	case idempotencyBackendNone:
+		return nil, nil
+	case idempotencyBackendMemory, "":
+		return newMemoryIdempotencyStore(ttl, maxKeys), nil
+	case idempotencyBackendFile:
+		if file == "" {
+			return nil, fmt.Errorf("IDEMPOTENCY_FILE must be set for the %q idempotency backend", backend)
+		}
+		return newFileIdempotencyStore(file, ttl, maxKeys)
+	}
+	return nil, fmt.Errorf("unknown IDEMPOTENCY_BACKEND %q, use %s, %s or %s", backend, idempotencyBackendMemory, idempotencyBackendFile, idempotencyBackendNone)
+}
+
+// Returns the idempotency key of an event: the CloudEvent ID plus the Keptn context
+// Event IDs are only unique per source, the Keptn context narrows them down to one sequence
+func idempotencyKey(event cloudevents.Event, keptnContext string) string {
+	return keptnContext + "/" + event.ID()
+}
+
+// keyIndex holds the claimed keys with their expiry. Keys are kept in claim order as well, which is also
+// their expiry order as all keys share one TTL, so expired keys are dropped from the front without a scan
+// At most maxKeys keys are kept, the oldest ones are dropped first
+type keyIndex struct {
+	ttl     time.Duration
+	maxKeys int
+	expires map[string]time.Time
+	order   []indexedKey
+}
+
+type indexedKey struct {
+	key     string
+	expires time.Time
+}
+
+func newKeyIndex(ttl time.Duration, maxKeys int) *keyIndex {
+	return &keyIndex{ttl: ttl, maxKeys: maxKeys, expires: map[string]time.Time{}}
+}
+
+// claim records key and reports false if it is already recorded and not yet expired
+func (x *keyIndex) claim(key string, now time.Time) bool {
+	x.prune(now)
+	if expiry, ok := x.expires[key]; ok && now.Before(expiry) {
+		return false
+	}
+	x.put(key, now.Add(x.ttl))
+	return true
+}
+
+// put records key until expires, e.g. when loading the file
+func (x *keyIndex) put(key string, expires time.Time) {
+	x.expires[key] = expires
+	x.order = append(x.order, indexedKey{key: key, expires: expires})
+	for x.maxKeys > 0 && len(x.expires) > x.maxKeys {
+		x.dropOldest()
+	}
+}
+
+// release forgets key and reports whether it was recorded
+func (x *keyIndex) release(key string) bool {
+	if _, ok := x.expires[key]; !ok {
+		return false
+	}
+	delete(x.expires, key)
+	return true
+}
+
+// prune drops the expired keys
+func (x *keyIndex) prune(now time.Time) {
+	for len(x.order) > 0 && !now.Before(x.order[0].expires) {
+		x.dropOldest()
+	}
+}
+
+func (x *keyIndex) dropOldest() {
+	oldest := x.order[0]
+	x.order[0] = indexedKey{}
+	x.order = x.order[1:]
+	// Released or claimed again later, the entry of the map belongs to a newer claim
+	if expiry, ok := x.expires[oldest.key]; ok && expiry.Equal(oldest.expires) {
+		delete(x.expires, oldest.key)
+	}
+}
+
+// memoryIdempotencyStore keeps the keys in memory. They are lost on restart
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys *keyIndex
+}
+
+func newMemoryIdempotencyStore(ttl time.Duration, maxKeys int) *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: newKeyIndex(ttl, maxKeys)}
+}
+
+func (s *memoryIdempotencyStore) Claim(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys.claim(key, time.Now()), nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys.release(key)
+	return nil
+}
+
+// The file of the file backend is compacted once it has this many more records than keys
+const idempotencyCompactAfter = 1000
+
+// idempotencyRecord is a line of the idempotency file. Claims and releases are appended,
+// the file is rewritten with the live keys only when it has grown too much, see compact
+type idempotencyRecord struct {
+	Key      string    `json:"key"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Released bool      `json:"released,omitempty"`
+}
+
+// fileIdempotencyStore keeps the keys in a file of JSON lines so that they survive restarts
+type fileIdempotencyStore struct {
+	mu      sync.Mutex
+	path    string
+	keys    *keyIndex
+	file    *os.File
+	records int
+}
+
+func newFileIdempotencyStore(path string, ttl time.Duration, maxKeys int) (*fileIdempotencyStore, error) {
+	s := &fileIdempotencyStore{path: path, keys: newKeyIndex(ttl, maxKeys)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// Start with a file without expired keys and released claims
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("could not write idempotency file: %w", err)
+	}
+	return s, nil
+}
+
+func (s *fileIdempotencyStore) Claim(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.keys.claim(key, time.Now()) {
+		return false, nil
+	}
+	if err := s.append(idempotencyRecord{Key: key, Expires: s.keys.expires[key]}); err != nil {
+		s.keys.release(key)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *fileIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.keys.release(key) {
+		return nil
+	}
+	return s.append(idempotencyRecord{Key: key, Released: true})
+}
+
+// load replays the records of the file. Files of earlier versions hold a single JSON object of keys and expiries
+func (s *fileIdempotencyStore) load() error {
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read idempotency file: %w", err)
+	}
+
+	legacy := map[string]time.Time{}
+	if err := json.Unmarshal(content, &legacy); err == nil {
+		keys := make([]string, 0, len(legacy))
+		for key := range legacy {
+			keys = append(keys, key)
+		}
+		// Oldest first, so that the claim order holds
+		sort.Slice(keys, func(i, j int) bool { return legacy[keys[i]].Before(legacy[keys[j]]) })
+		for _, key := range keys {
+			s.keys.put(key, legacy[key])
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record := idempotencyRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A crash may leave a partial last line behind
+			slog.Warn("Skipping invalid line of the idempotency file", "file", s.path, "line", line, "error", err)
+			continue
+		}
+		if record.Released {
+			s.keys.release(record.Key)
+		} else {
+			s.keys.put(record.Key, record.Expires)
+		}
+	}
+	return scanner.Err()
+}
+
+// append writes a record to the end of the file and compacts it once it has grown too much
+func (s *fileIdempotencyStore) append(record idempotencyRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.records++
+
+	if s.records > len(s.keys.expires)+idempotencyCompactAfter {
+		if err := s.compact(); err != nil {
+			// The appended record is safe, the file is compacted with the next record
+			slog.Warn("Could not compact the idempotency file", "file", s.path, "error", err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the file with the live keys only, via a temporary file and a rename
+func (s *fileIdempotencyStore) compact() error {
+	s.keys.prune(time.Now())
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".idempotency-")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	records := 0
+	for _, entry := range s.keys.order {
+		// Skip released keys and superseded claims
+		if expiry, ok := s.keys.expires[entry.key]; !ok || !expiry.Equal(entry.expires) {
+			continue
+		}
+		line, err := json.Marshal(idempotencyRecord{Key: entry.key, Expires: entry.expires})
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		writer.Write(append(line, '\n'))
+		records++
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.records = records
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyIndex(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		at      time.Duration
+		claim   string
+		release string
+		want    bool
+	}
+	tests := []struct {
+		name    string
+		maxKeys int
+		steps   []step
+	}{
+		{
+			name: "duplicate",
+			steps: []step{
+				{claim: "a", want: true},
+				{at: time.Minute, claim: "a", want: false},
+			},
+		},
+		{
+			name: "expired",
+			steps: []step{
+				{claim: "a", want: true},
+				{at: time.Hour, claim: "a", want: true},
+			},
+		},
+		{
+			name: "released",
+			steps: []step{
+				{claim: "a", want: true},
+				{release: "a", want: true},
+				{claim: "a", want: true},
+				{claim: "a", want: false},
+			},
+		},
+		{
+			name: "release unknown key",
+			steps: []step{
+				{release: "a", want: false},
+			},
+		},
+		{
+			name:    "oldest dropped beyond max keys",
+			maxKeys: 2,
+			steps: []step{
+				{claim: "a", want: true},
+				{claim: "b", want: true},
+				{claim: "c", want: true},
+				{claim: "b", want: false},
+				{claim: "a", want: true},
+			},
+		},
+		{
+			name: "claimed again after release survives expiry of the first claim",
+			steps: []step{
+				{claim: "a", want: true},
+				{release: "a", want: true},
+				{at: 30 * time.Minute, claim: "a", want: true},
+				{at: 61 * time.Minute, claim: "a", want: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newKeyIndex(time.Hour, tt.maxKeys)
+			for i, s := range tt.steps {
+				if s.claim != "" {
+					if got := index.claim(s.claim, start.Add(s.at)); got != s.want {
+						t.Fatalf("step %d: claim(%q) = %v, want %v", i, s.claim, got, s.want)
+					}
+				} else if got := index.release(s.release); got != s.want {
+					t.Fatalf("step %d: release(%q) = %v, want %v", i, s.release, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+
+	store, err := newFileIdempotencyStore(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if claimed, err := store.Claim(key); err != nil || !claimed {
+			t.Fatalf("Claim(%q) = %v, %v", key, claimed, err)
+		}
+	}
+	if err := store.Release("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := countLines(t, path); got != 4 {
+		t.Errorf("file has %d lines, want 4 (3 claims, 1 release)", got)
+	}
+
+	// A restart keeps the claims and compacts the file
+	store, err = newFileIdempotencyStore(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "a", want: false},
+		{key: "b", want: true},
+		{key: "c", want: false},
+		{key: "d", want: true},
+	}
+	for _, tt := range tests {
+		if claimed, err := store.Claim(tt.key); err != nil || claimed != tt.want {
+			t.Errorf("Claim(%q) after restart = %v, %v, want %v", tt.key, claimed, err, tt.want)
+		}
+	}
+	if got := countLines(t, path); got != 4 {
+		t.Errorf("file has %d lines, want 4 (2 compacted claims, 2 new ones)", got)
+	}
+}
+
+func TestFileIdempotencyStoreLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	if err := os.WriteFile(path, []byte(`{"ctx/1":"`+expires+`"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := newFileIdempotencyStore(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := store.Claim("ctx/1"); err != nil || claimed {
+		t.Errorf("Claim() of a key of the legacy file = %v, %v, want false", claimed, err)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
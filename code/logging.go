@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats for LOG_FORMAT
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// Attribute keys whose values are always masked, e.g. "authorization" or "apiToken"
+var sensitiveKeyPattern = regexp.MustCompile(`(?i)(authorization|token|secret|password|credential)`)
+
+var (
+	// Credentials are at least 8 characters long, so that text like "bearer or basic" is left alone
+	authorizationPattern = regexp.MustCompile(`(?i)\b(bearer|basic|api-token)(\s+)[A-Za-z0-9._~+/=-]{8,}`)
+	authHeaderPattern    = regexp.MustCompile(`(?i)(authorization["']?\s*[:=]\s*["']?(?:(?:bearer|basic|api-token)\s+)?)[^\s"',;]+`)
+	emailPattern         = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+)
+
+const redacted = "[REDACTED]"
+
+// Installs a structured logger as slog and log default
+//   - level is debug, info, warn or error. Empty means info
+//   - format is json or text
+//
+// Every line is redacted, see redact, and carries the fields of the event being handled, see withEventLogFields
+func setupLogging(level string, format string) error {
+	handler, err := newLogHandler(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func newLogHandler(w io.Writer, level string, format string) (slog.Handler, error) {
+	if level == "" {
+		level = "info"
+	}
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q, expected debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr}
+	switch format {
+	case "", logFormatJSON:
+		return &contextHandler{slog.NewJSONHandler(w, options)}, nil
+	case logFormatText:
+		return &contextHandler{slog.NewTextHandler(w, options)}, nil
+	}
+	return nil, fmt.Errorf("invalid LOG_FORMAT %q, expected %s or %s", format, logFormatJSON, logFormatText)
+}
+
+type logFieldsKey struct{}
+
+// logFields are attached to every line logged with a context of an event
+type logFields struct {
+	eventID string
+	attrs   []slog.Attr
+}
+
+// Adds keptnContext, eventID, eventType, project, stage and service of an event to ctx
+// Calling it again for the same event is a no-op
+func withEventLogFields(ctx context.Context, event cloudevents.Event) context.Context {
+	if fields, ok := ctx.Value(logFieldsKey{}).(*logFields); ok && fields.eventID == event.ID() {
+		return ctx
+	}
+
+	keptnContext, _ := event.Context.GetExtension("shkeptncontext")
+	data := keptnv2.EventData{}
+	// Malformed payloads are reported by the handlers
+	_ = event.DataAs(&data)
+
+	return context.WithValue(ctx, logFieldsKey{}, &logFields{
+		eventID: event.ID(),
+		attrs: []slog.Attr{
+			slog.String("keptnContext", fmt.Sprint(keptnContext)),
+			slog.String("eventID", event.ID()),
+			slog.String("eventType", event.Type()),
+			slog.String("project", data.GetProject()),
+			slog.String("stage", data.GetStage()),
+			slog.String("service", data.GetService()),
+		},
+	})
+}
+
+// contextHandler adds the event fields and the trace and span ID of ctx to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields, ok := ctx.Value(logFieldsKey{}).(*logFields); ok {
+		record.AddAttrs(fields.attrs...)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("traceID", spanContext.TraceID().String()), slog.String("spanID", spanContext.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Secrets that are masked wherever they appear
+var logSecrets struct {
+	sync.RWMutex
+	values map[string]bool
+}
+
+// Remembers secrets, e.g. API tokens, so that they are masked wherever they appear
+func registerLogSecrets(secrets ...string) {
+	logSecrets.Lock()
+	defer logSecrets.Unlock()
+	if logSecrets.values == nil {
+		logSecrets.values = map[string]bool{}
+	}
+	for _, secret := range secrets {
+		// Very short values would mask unrelated text
+		if len(secret) >= 4 {
+			logSecrets.values[secret] = true
+		}
+	}
+}
+
+// Masks secrets, Authorization headers and e-mail addresses (j***@example.com)
+func redact(text string) string {
+	logSecrets.RLock()
+	for secret := range logSecrets.values {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	logSecrets.RUnlock()
+
+	text = authorizationPattern.ReplaceAllString(text, "${1}${2}"+redacted)
+	text = authHeaderPattern.ReplaceAllString(text, "${1}"+redacted)
+	return emailPattern.ReplaceAllString(text, "${1}***@${2}")
+}
+
+// ReplaceAttr of the log handler: masks sensitive keys and redacts strings (including the message) and errors
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeyPattern.MatchString(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, redact(err.Error()))
+		}
+	}
+	return attr
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	registerLogSecrets("s3cr3t-api-token", "abc")
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain text", text: "Created Zendesk ticket 42", want: "Created Zendesk ticket 42"},
+		{name: "registered secret", text: "token is s3cr3t-api-token!", want: "token is [REDACTED]!"},
+		{name: "short values are not registered", text: "abc def", want: "abc def"},
+		{name: "bearer token", text: "sent Bearer eyJhbGciOiJIUzI1NiJ9.payload", want: "sent Bearer [REDACTED]"},
+		{name: "basic credentials", text: "basic amFuZUBleGFtcGxlLmNvbTp0b2tlbg==", want: "basic [REDACTED]"},
+		{name: "dynatrace token", text: "Api-Token dt0c01.ABCDEFGH.IJKLMNOP", want: "Api-Token [REDACTED]"},
+		{name: "words after bearer are left alone", text: "expected bearer or basic auth", want: "expected bearer or basic auth"},
+		{name: "authorization header", text: `Authorization: Bearer abcdefghijkl`, want: `Authorization: Bearer [REDACTED]`},
+		{name: "authorization json", text: `{"authorization":"xyz123"}`, want: `{"authorization":"[REDACTED]"}`},
+		{name: "e-mail", text: "user jane.doe@example.com not found", want: "user j***@example.com not found"},
+		{name: "e-mail in token auth", text: "jane@example.com/token", want: "j***@example.com/token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(tt.text); got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	tests := []struct {
+		name string
+		attr slog.Attr
+		want string
+	}{
+		{name: "sensitive key", attr: slog.String("apiToken", "anything"), want: redacted},
+		{name: "sensitive key of another kind", attr: slog.Int("clientSecret", 42), want: redacted},
+		{name: "authorization key", attr: slog.String("Authorization", "Basic x"), want: redacted},
+		{name: "string value", attr: slog.String("requester", "jane@example.com"), want: "j***@example.com"},
+		{name: "error value", attr: slog.Any("error", errors.New("401 for Bearer abcdefghijkl")), want: "401 for Bearer [REDACTED]"},
+		{name: "other value", attr: slog.Int("ticketID", 42), want: "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactAttr(nil, tt.attr)
+			if got.Key != tt.attr.Key {
+				t.Errorf("key = %q, want %q", got.Key, tt.attr.Key)
+			}
+			if got.Value.String() != tt.want {
+				t.Errorf("value = %q, want %q", got.Value.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLogHandlerRedacts(t *testing.T) {
+	tests := []struct {
+		format string
+	}{
+		{format: logFormatJSON},
+		{format: logFormatText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			handler, err := newLogHandler(&out, "info", tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slog.New(handler).InfoContext(context.Background(), "Calling Zendesk as jane@example.com", "header", "Bearer abcdefghijkl", "token", "t0ken")
+
+			line := out.String()
+			for _, leaked := range []string{"jane@", "abcdefghijkl", "t0ken"} {
+				if strings.Contains(line, leaked) {
+					t.Errorf("log line contains %q: %s", leaked, line)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLogHandlerInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		level  string
+		format string
+	}{
+		{name: "level", level: "verbose", format: logFormatJSON},
+		{name: "format", level: "info", format: "xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newLogHandler(&bytes.Buffer{}, tt.level, tt.format); err == nil {
+				t.Errorf("newLogHandler(%q, %q) = nil error", tt.level, tt.format)
+			}
+		})
+	}
+}
@@ -1,18 +1,22 @@
 package main
 
 /*
- * Reacts to sh.keptn.event.evaluation.finished and sh.keptn.event.remediation.finished
+ * Reacts to sh.keptn.event.evaluation.finished, sh.keptn.event.remediation.finished,
+ * sh.keptn.event.deployment.finished, sh.keptn.event.test.finished, sh.keptn.event.release.finished
+ * as well as sh.keptn.event.approval.triggered and sh.keptn.event.zendesk.triggered
  */
 
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
-	"strconv"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
-	"github.com/kelseyhightower/envconfig"
 
 	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
@@ -29,58 +33,234 @@ type envConfig struct {
 	Env string `envconfig:"ENV" default:"local"`
 	// URL of the Keptn configuration service (this is where we can fetch files from the config repo)
 	ConfigurationServiceUrl string `envconfig:"CONFIGURATION_SERVICE" default:""`
+	// Backend of the idempotency store: memory, file or none
+	IdempotencyBackend string `envconfig:"IDEMPOTENCY_BACKEND" default:"memory"`
+	// How long handled events are remembered
+	IdempotencyTTL time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"24h"`
+	// Upper bound of remembered events, the oldest are forgotten first
+	IdempotencyMaxKeys int `envconfig:"IDEMPOTENCY_MAX_KEYS" default:"100000"`
+	// File of the file backend
+	IdempotencyFile string `envconfig:"IDEMPOTENCY_FILE" default:""`
+	// File the pending approvals are kept in. If empty, they are lost on restart
+	ApprovalStateFile string `envconfig:"APPROVAL_STATE_FILE" default:""`
+	// How often the tickets of pending approvals are checked
+	ApprovalPollInterval time.Duration `envconfig:"APPROVAL_POLL_INTERVAL" default:"1m"`
+	// Port of the Zendesk webhook receiver. 0 disables it
+	WebhookPort int `envconfig:"WEBHOOK_PORT" default:"0"`
+	// Path of the Zendesk webhook receiver
+	WebhookPath string `envconfig:"WEBHOOK_PATH" default:"/zendesk"`
+	// Signing secret of the Zendesk webhook
+	WebhookSecret string `envconfig:"ZENDESK_WEBHOOK_SECRET" default:""`
+	// Endpoint Keptn events are sent to, defaults to the distributor sidecar
+	KeptnEventEndpoint string `envconfig:"KEPTN_EVENT_ENDPOINT" default:""`
+	// Directory of the durable outbox. If empty, events are handled synchronously
+	OutboxDir string `envconfig:"OUTBOX_DIR" default:""`
+	// Attempts before an outbox item is moved to the dead letters
+	OutboxMaxAttempts int `envconfig:"OUTBOX_MAX_ATTEMPTS" default:"10"`
+	// How often the outbox worker looks for due items
+	OutboxPollInterval time.Duration `envconfig:"OUTBOX_POLL_INTERVAL" default:"5s"`
+	// Port of the operations server (/metrics, /healthz, /readyz). 0 disables it
+	OpsPort int `envconfig:"OPS_PORT" default:"9090"`
+	// How often the readiness checks verify the configuration and the Zendesk and Dynatrace credentials
+	HealthCheckInterval time.Duration `envconfig:"HEALTH_CHECK_INTERVAL" default:"1m"`
+	// Whether a failed Zendesk check fails readiness. Otherwise it only reports the service as degraded
+	ReadinessRequiresZendesk bool `envconfig:"READINESS_REQUIRES_ZENDESK" default:"false"`
+	// Trace exporter: otlp, stdout or none. The OTLP exporter reads the standard OTEL_EXPORTER_OTLP_* env vars
+	TracesExporter string `envconfig:"OTEL_TRACES_EXPORTER" default:"none"`
+	// debug, info, warn or error. Defaults to info, or debug if DEBUG is true
+	LogLevel string `envconfig:"LOG_LEVEL" default:""`
+	// json or text
+	LogFormat string `envconfig:"LOG_FORMAT" default:"json"`
+	// Shorthand for LOG_LEVEL=debug
+	Debug bool `envconfig:"DEBUG" default:"false"`
+	// Comma separated list of the sinks notified about tickets, see setupSinks
+	Sinks string `envconfig:"SINKS" default:""`
+	// Enables the dynatrace sink if SINKS is not set
+	SendEvent bool `envconfig:"SEND_EVENT" default:"false"`
+	// Directory with one file per setting, e.g. a mounted secret. The files win over the environment
+	ConfigDir string `envconfig:"CONFIG_DIR" default:""`
+	// How often CONFIG_DIR is checked for changes
+	ConfigReloadInterval time.Duration `envconfig:"CONFIG_RELOAD_INTERVAL" default:"10s"`
 }
 
-type ZendeskDetails struct {
-	BaseURL              string
-	EndUserEmail         string
-	APIToken             string
-	TicketForProblems    bool
-	TicketForEvaluations bool
-}
+// ServiceName specifies the current services name (e.g., used as source when sending CloudEvents)
+const ServiceName = "zendesk-service"
 
-type KeptnDetails struct {
-	Domain    string
-	BridgeURL string
+// This method gets called when a new event is received from the Keptn Event Distributor
+// Errors are never fatal: they are mapped onto a CloudEvents result, see eventResult
+func processKeptnCloudEvent(ctx context.Context, cfg *Config, event cloudevents.Event) (result cloudevents.Result) {
+	atomic.AddUint64(&eventStats.received, 1)
+	observeEventReceived(event.Type())
+
+	ctx = withEventLogFields(ctx, event)
+	ctx, span := startEventSpan(ctx, "processKeptnCloudEvent", event)
+	defer func() {
+		if !cloudevents.IsACK(result) {
+			endSpan(span, result)
+			return
+		}
+		endSpan(span, nil)
+	}()
+
+	// With an outbox the event is acknowledged once it is persisted, the outbox worker handles it
+	if eventOutbox != nil {
+		setEventTraceContext(ctx, &event)
+		if err := eventOutbox.enqueue(event); err != nil {
+			return eventResult(ctx, event, transientError(fmt.Errorf("could not persist event in the outbox: %w", err)))
+		}
+		return cloudevents.ResultACK
+	}
+
+	// A bug in a handler must not take down the service with all in-flight events
+	defer func() {
+		if r := recover(); r != nil {
+			result = eventResult(ctx, event, permanentError(fmt.Errorf("panic while handling event: %v", r)))
+		}
+	}()
+
+	return eventResult(ctx, event, handleKeptnCloudEvent(ctx, cfg, event))
 }
 
-var ZENDESK_DETAILS ZendeskDetails
-var KEPTN_DETAILS KeptnDetails
+// Fetches resources from the configuration service, see fetchKeptnResource
+var configurationServiceHTTPClient = instrumentedHTTPClient(downstreamConfigurationService, 30*time.Second)
 
-// ServiceName specifies the current services name (e.g., used as source when sending CloudEvents)
-const ServiceName = "zendesk-service"
+// Creates the Keptn handler of an event. Its resource handler gets a client of its own instead of the
+// one go-utils builds, which skips certificate verification
+func newKeptnHandler(event *cloudevents.Event) (*keptnv2.Keptn, error) {
+	myKeptn, err := keptnv2.NewKeptn(event, keptnOptions)
+	if err != nil {
+		return nil, err
+	}
+	if myKeptn.ResourceHandler != nil {
+		myKeptn.ResourceHandler.HTTPClient = configurationServiceHTTPClient
+	}
+	return myKeptn, nil
+}
 
-// This method gets called when a new event is received from the Keptn Event Distributor
-func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error {
+func handleKeptnCloudEvent(ctx context.Context, cfg *Config, event cloudevents.Event) (err error) {
+	ctx = withEventLogFields(ctx, event)
+	ctx, span := startEventSpan(ctx, "handleKeptnCloudEvent", event)
+	defer func() { endSpan(span, err) }()
+
+	slog.InfoContext(ctx, "Received event")
 
 	// create keptn handler
-	log.Printf("[main.go] Initializing Keptn Handler")
-	myKeptn, err := keptnv2.NewKeptn(&event, keptnOptions)
+	slog.DebugContext(ctx, "Initializing Keptn handler")
+	myKeptn, err := newKeptnHandler(&event)
 	if err != nil {
-		return errors.New("Could not create Keptn Handler: " + err.Error())
+		return permanentError(errors.New("Could not create Keptn Handler: " + err.Error()))
+	}
+
+	// Redelivered events must not open duplicate tickets
+	if processedEvents != nil {
+		key := idempotencyKey(event, myKeptn.KeptnContext)
+		claimed, claimErr := processedEvents.Claim(key)
+		if claimErr != nil {
+			slog.WarnContext(ctx, "Could not check event for duplicates, handling it anyway", "key", key, "error", claimErr)
+		} else if !claimed {
+			duplicates := atomic.AddUint64(&eventStats.duplicates, 1)
+			observeEventProcessed(event.Type(), eventOutcomeDuplicate)
+			slog.InfoContext(ctx, "Skipping duplicate event, it was handled already", "key", key, "duplicates", duplicates)
+			return nil
+		} else {
+			// Failed events are processed again when they are redelivered or replayed
+			defer func() {
+				if err != nil {
+					if releaseErr := processedEvents.Release(key); releaseErr != nil {
+						slog.WarnContext(ctx, "Could not release event", "key", key, "error", releaseErr)
+					}
+				}
+			}()
+		}
 	}
 
-	setupAndDebug(myKeptn, event)
+	// A panicking handler fails the event like any other error. Runs before the release above,
+	// so that the key of the event is released and a redelivery or replay handles it again
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "Panic while handling event", "panic", r, "stack", string(debug.Stack()))
+			err = permanentError(fmt.Errorf("panic while handling event: %v", r))
+		}
+	}()
 
 	switch event.Type() {
 
 	// Listen for remediation.finished
 	case keptnv2.GetFinishedEventType(keptnv2.RemediationTaskName): // sh.keptn.event.remediation.finished
-		log.Printf("Processing Remediation.Finished Event")
+		slog.DebugContext(ctx, "Processing Remediation.finished event")
 
 		eventData := &keptnv2.RemediationFinishedEventData{}
-		parseKeptnCloudEventPayload(event, eventData)
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
 
-		HandleRemediationFinishedEvent(myKeptn, event, eventData)
+		return HandleRemediationFinishedEvent(ctx, cfg, myKeptn, event, eventData)
 
 	// Handle evaluation.finished event type
 	case keptnv2.GetFinishedEventType(keptnv2.EvaluationTaskName): // sk.keptn.event.evaluation.finished
-		log.Printf("Processing Evaluation.Finished Event")
+		slog.DebugContext(ctx, "Processing Evaluation.finished event")
 
 		eventData := &keptnv2.EvaluationFinishedEventData{}
-		parseKeptnCloudEventPayload(event, eventData)
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
 
-		HandleEvaluationFinishedEvent(myKeptn, event, eventData)
+		return HandleEvaluationFinishedEvent(ctx, cfg, myKeptn, event, eventData)
+
+	// Handle deployment.finished event type
+	case keptnv2.GetFinishedEventType(keptnv2.DeploymentTaskName): // sh.keptn.event.deployment.finished
+		slog.DebugContext(ctx, "Processing Deployment.finished event")
+
+		eventData := &keptnv2.DeploymentFinishedEventData{}
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
+
+		return HandleDeploymentFinishedEvent(ctx, cfg, myKeptn, event, eventData)
+
+	// Handle test.finished event type
+	case keptnv2.GetFinishedEventType(keptnv2.TestTaskName): // sh.keptn.event.test.finished
+		slog.DebugContext(ctx, "Processing Test.finished event")
+
+		eventData := &keptnv2.TestFinishedEventData{}
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
+
+		return HandleTestFinishedEvent(ctx, cfg, myKeptn, event, eventData)
+
+	// Handle release.finished event type
+	case keptnv2.GetFinishedEventType(keptnv2.ReleaseTaskName): // sh.keptn.event.release.finished
+		slog.DebugContext(ctx, "Processing Release.finished event")
+
+		eventData := &keptnv2.ReleaseFinishedEventData{}
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
+
+		return HandleReleaseFinishedEvent(ctx, cfg, myKeptn, event, eventData)
+
+	// Handle approval.triggered event type
+	case keptnv2.GetTriggeredEventType(keptnv2.ApprovalTaskName): // sh.keptn.event.approval.triggered
+		slog.DebugContext(ctx, "Processing Approval.triggered event")
+
+		eventData := &approvalTriggeredEventData{}
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
+
+		return HandleApprovalTriggeredEvent(ctx, cfg, myKeptn, event, eventData)
+
+	// Handle zendesk.triggered event type, i.e. the zendesk task of a shipyard sequence
+	case keptnv2.GetTriggeredEventType(zendeskTaskName): // sh.keptn.event.zendesk.triggered
+		slog.DebugContext(ctx, "Processing Zendesk.triggered event")
+
+		eventData := &ZendeskTriggeredEventData{}
+		if err := parseKeptnCloudEventPayload(ctx, event, eventData); err != nil {
+			return err
+		}
+
+		return HandleZendeskTriggeredEvent(ctx, cfg, myKeptn, event, eventData)
 	}
 
 	return nil
@@ -95,47 +275,146 @@ func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error
  * env=runlocal   -> will fetch resources from local drive instead of configuration service
  */
 func main() {
-	var env envConfig
-	if err := envconfig.Process("", &env); err != nil {
-		log.Fatalf("[main.go] Failed to process env var: %s", err)
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("Failed to process env var", "error", err)
+		os.Exit(1)
+	}
+	if err := setupLogging(cfg.LogLevel, cfg.LogFormat); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
+	registerLogSecrets(cfg.secrets()...)
 
-	os.Exit(_main(os.Args[1:], env))
+	os.Exit(_main(os.Args[1:], cfg))
 }
 
 /**
  * Opens up a listener on localhost:port/path and passes incoming requets to gotEvent
  */
-func _main(args []string, env envConfig) int {
+func _main(args []string, cfg *Config) int {
+	// Operator commands, e.g. "outbox replay all"
+	if len(args) > 0 && args[0] == "outbox" {
+		return runOutboxCommand(args[1:], cfg.envConfig)
+	}
+
+	// Fail fast instead of dropping tickets later
+	if err := cfg.validate(); err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		return 1
+	}
+
 	// configure keptn options
-	if env.Env == "local" {
-		log.Println("[main.go] env=local: Running with local filesystem to fetch resources")
+	if cfg.Env == "local" {
+		slog.Info("env=local: Running with local filesystem to fetch resources")
 		keptnOptions.UseLocalFileSystem = true
 	}
 
-	keptnOptions.ConfigurationServiceURL = env.ConfigurationServiceUrl
+	keptnOptions.ConfigurationServiceURL = cfg.ConfigurationServiceUrl
+
+	// Handlers load the live configuration from here, it changes when the files in CONFIG_DIR do
+	config := newConfigSource(cfg)
+
+	// Sinks are notified about every ticket, see SINKS
+	notificationSinks = setupSinks(config)
+	logConfig(cfg)
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.TracesExporter)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	defer func() {
+		// Flush the spans of the last events
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("Could not flush traces", "error", err)
+		}
+	}()
 
-	log.Printf("[main.go] Starting %s...", ServiceName)
-	log.Printf("[main.go]     on Port = %d; Path=%s", env.Port, env.Path)
+	slog.Info("Starting "+ServiceName, "port", cfg.Port, "path", cfg.Path)
 
 	ctx := context.Background()
 	ctx = cloudevents.WithEncodingStructured(ctx)
 
-	log.Printf("[main.go] Creating new http handler")
+	store, err := newIdempotencyStore(cfg.IdempotencyBackend, cfg.IdempotencyTTL, cfg.IdempotencyMaxKeys, cfg.IdempotencyFile)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	processedEvents = store
+
+	if cfg.ConfigDir != "" {
+		go config.watch(ctx)
+	}
+
+	approvals, err := newApprovalWatcher(config, cfg.ApprovalStateFile, cfg.ApprovalPollInterval)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	pendingApprovals = approvals
+	go pendingApprovals.run(ctx)
+
+	if cfg.WebhookPort != 0 {
+		receiver, err := newWebhookReceiver(config)
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		go func() {
+			if err := receiver.listen(ctx, cfg.WebhookPort, cfg.WebhookPath); err != nil {
+				slog.Error("Webhook receiver stopped", "error", err)
+			}
+		}()
+	}
+
+	if cfg.OpsPort != 0 {
+		health := newHealthChecker(config, cfg.HealthCheckInterval, cfg.ReadinessRequiresZendesk)
+		go health.run(ctx)
+		go func() {
+			if err := listenOps(ctx, cfg.OpsPort, health); err != nil {
+				slog.Error("Operations server stopped", "error", err)
+			}
+		}()
+	}
+
+	if cfg.OutboxDir != "" {
+		o, err := newOutbox(cfg.OutboxDir, cfg.OutboxMaxAttempts, cfg.OutboxPollInterval, func(ctx context.Context, event cloudevents.Event) error {
+			return handleKeptnCloudEvent(ctx, config.Load(), event)
+		})
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		eventOutbox = o
+		go eventOutbox.run(ctx)
+	}
+
+	slog.Debug("Creating new http handler")
 
 	// configure http server to receive cloudevents
-	p, err := cloudevents.NewHTTP(cloudevents.WithPath(env.Path), cloudevents.WithPort(env.Port))
+	p, err := cloudevents.NewHTTP(cloudevents.WithPath(cfg.Path), cloudevents.WithPort(cfg.Port))
 
 	if err != nil {
-		log.Fatalf("[main.go] failed to create client, %v", err)
+		slog.Error("Failed to create client", "error", err)
+		return 1
 	}
 	c, err := cloudevents.NewClient(p)
 	if err != nil {
-		log.Fatalf("failed to create client, %v", err)
+		slog.Error("Failed to create client", "error", err)
+		return 1
 	}
 
-	log.Printf("[main.go] Starting receiver")
-	log.Fatal(c.StartReceiver(ctx, processKeptnCloudEvent))
+	slog.Info("Starting receiver")
+	receive := func(ctx context.Context, event cloudevents.Event) cloudevents.Result {
+		return processKeptnCloudEvent(ctx, config.Load(), event)
+	}
+	if err := c.StartReceiver(ctx, receive); err != nil {
+		slog.Error("Receiver stopped", "error", err)
+		return 1
+	}
 
 	return 0
 }
@@ -143,87 +422,34 @@ func _main(args []string, env envConfig) int {
 /**
  * Parses a Keptn Cloud Event payload (data attribute)
  */
-func parseKeptnCloudEventPayload(event cloudevents.Event, data interface{}) error {
+func parseKeptnCloudEventPayload(ctx context.Context, event cloudevents.Event, data interface{}) error {
 	err := event.DataAs(data)
 	if err != nil {
-		log.Fatalf("Got Data Error: %s", err.Error())
-		return err
+		slog.ErrorContext(ctx, "Got data error", "error", err)
+		// Redelivering a malformed payload won't help
+		return permanentError(fmt.Errorf("could not parse event data: %w", err))
 	}
 	return nil
 }
 
-func setZendeskDetails() {
-	ZENDESK_DETAILS.BaseURL = os.Getenv("ZENDESK_BASE_URL")
-	ZENDESK_DETAILS.EndUserEmail = os.Getenv("ZENDESK_END_USER_EMAIL")
-	ZENDESK_DETAILS.APIToken = os.Getenv("ZENDESK_API_TOKEN")
-	ZENDESK_DETAILS.TicketForProblems, _ = strconv.ParseBool(os.Getenv("ZENDESK_TICKET_FOR_PROBLEMS"))
-	ZENDESK_DETAILS.TicketForEvaluations, _ = strconv.ParseBool(os.Getenv("ZENDESK_TICKET_FOR_EVALUATIONS"))
-}
-
-func setKeptnDetails() {
-	KEPTN_DETAILS.Domain = os.Getenv("KEPTN_DOMAIN")
-
-	// If Bridge URL isn't set in YAML file, default to the KEPTN_DOMAIN which is mandatory
-	if os.Getenv("KEPTN_BRIDGE_URL") == "" {
-		KEPTN_DETAILS.BridgeURL = os.Getenv("KEPTN_DOMAIN")
-	} else {
-		KEPTN_DETAILS.BridgeURL = os.Getenv("KEPTN_BRIDGE_URL")
-	}
-}
-
-func setupAndDebug(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event) {
-	log.Printf("[main.go] gotEvent(%s): %s - %s", incomingEvent.Type(), myKeptn.KeptnContext, incomingEvent.Context.GetID())
-
-	// Get Debug Mode
-	// This is set in the service.yaml as DEBUG "true"
-	DEBUG, _ := strconv.ParseBool(os.Getenv("DEBUG"))
-	log.Printf("[main.go] Debug Mode: %v \n", DEBUG)
-
-	// Set Zendesk Details
-	setZendeskDetails()
-
-	// Get Dynatrace Tenant
-	dynaTraceTenant := os.Getenv("DT_TENANT")
-
-	// KEPTN_DOMAIN must be set but KEPTN_BRIDGE_URL is optional in zendesk-service deployment.yaml file
-	setKeptnDetails()
-
-	if ZENDESK_DETAILS.BaseURL == "" ||
-		KEPTN_DETAILS.Domain == "" {
-		log.Println("[main.go] Missing mandatory input parameters ZENDESK_DETAILS and / or KEPTN_DOMAIN.")
-	}
-
-	if DEBUG {
-		log.Println("[main.go] --- Printing Zendesk Input Details ---")
-		log.Printf("[main.go] Base URL: %s \n", ZENDESK_DETAILS.BaseURL)
-		log.Printf("[main.go] Ticket For Problems: %v \n", ZENDESK_DETAILS.TicketForProblems)
-		log.Printf("[main.go] Ticket For Problems: %v \n", ZENDESK_DETAILS.TicketForEvaluations)
-		log.Println("[main.go] --- End Printing Zendesk Input Details ---")
-
-		log.Printf("[main.go] Dynatrace Tenant: %s \n", dynaTraceTenant)
-		log.Printf("[main.go] Keptn Domain: %s \n", KEPTN_DETAILS.Domain)
-		log.Printf("[main.go] Keptn Bridge URL: %s \n", KEPTN_DETAILS.BridgeURL)
-
-		// At this point, we have all mandatory input params. Proceed
-		log.Println("[main.go] Got all input variables. Proceeding...")
-
-		if ZENDESK_DETAILS.TicketForProblems {
-			log.Println("[main.go] Will create tickets for problems")
-		} else {
-			log.Println("[main.go] Will NOT create tickets for problems")
-		}
-
-		if ZENDESK_DETAILS.TicketForEvaluations {
-			log.Println("[main.go] Will create tickets for evaluations")
-		} else {
-			log.Println("[main.go] Will NOT create tickets for evaluations")
-		}
-
-		SEND_EVENT, _ := strconv.ParseBool(os.Getenv("SEND_EVENT"))
-		if SEND_EVENT {
-			log.Println("[main.go] Will send events")
-		} else {
-			log.Println("[main.go] Will NOT send events")
-		}
-	}
+// Logs the configuration at debug level (LOG_LEVEL=debug or DEBUG=true). Secrets are left out
+func logConfig(cfg *Config) {
+	slog.Debug("Configuration",
+		slog.Group("zendesk",
+			"baseURL", cfg.Zendesk.BaseURL,
+			"authMethod", cfg.Zendesk.AuthMethod,
+			"endUserEmail", cfg.Zendesk.EndUserEmail,
+			"ticketForProblems", cfg.Zendesk.TicketForProblems,
+			"ticketForEvaluations", cfg.Zendesk.TicketForEvaluations,
+			"ticketForDeployments", cfg.Zendesk.TicketForDeployments,
+			"ticketForTests", cfg.Zendesk.TicketForTests,
+			"ticketForReleases", cfg.Zendesk.TicketForReleases,
+			"ticketForApprovals", cfg.Zendesk.TicketForApprovals,
+			"maxRetries", cfg.Zendesk.MaxRetries,
+			"recoveryPolicy", cfg.Zendesk.RecoveryPolicy),
+		slog.Group("keptn",
+			"domain", cfg.Keptn.Domain,
+			"bridgeURL", cfg.Keptn.BridgeURL),
+		"dynatraceTenant", cfg.Dynatrace.Tenant,
+		"sinks", describeSinks(notificationSinks))
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestHandleKeptnCloudEventRedelivery(t *testing.T) {
+	useTestIdempotencyStore(t)
+
+	evaluationType := keptnv2.GetFinishedEventType(keptnv2.EvaluationTaskName)
+	evaluation := newTestEvent(t, evaluationType, keptnv2.EvaluationFinishedEventData{
+		EventData: keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts", Result: keptnv2.ResultFailed},
+	})
+	malformed := newTestEvent(t, evaluationType, nil)
+	if err := malformed.SetData(cloudevents.ApplicationJSON, []byte(`{"project":`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		cfg   *Config
+		event cloudevents.Event
+		// Whether handling fails, a failed event is handled again on redelivery
+		wantErr bool
+	}{
+		// Tickets for evaluations are disabled in validConfig, so the event is handled without calling Zendesk
+		{name: "handled", cfg: validConfig(), event: evaluation},
+		{name: "failed", cfg: validConfig(), event: malformed, wantErr: true},
+		// Handlers dereference the configuration, without one they panic
+		{name: "panicked", event: evaluation, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each case has an idempotency key of its own
+			event := tt.event.Clone()
+			event.SetID(tt.name)
+
+			for delivery := 1; delivery <= 2; delivery++ {
+				duplicates := atomic.LoadUint64(&eventStats.duplicates)
+				err := handleKeptnCloudEvent(context.Background(), tt.cfg, event)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("delivery %d: handleKeptnCloudEvent() error = %v, wantErr %v", delivery, err, tt.wantErr)
+				}
+
+				skipped := atomic.LoadUint64(&eventStats.duplicates) != duplicates
+				wantSkipped := delivery == 2 && !tt.wantErr
+				if skipped != wantSkipped {
+					t.Errorf("delivery %d: skipped as duplicate = %v, want %v", delivery, skipped, wantSkipped)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prefix of all metrics of the service
+const metricsNamespace = "zendesk_service"
+
+// Outcomes of incoming events, see eventResult
+const (
+	eventOutcomeHandled          = "handled"
+	eventOutcomeDuplicate        = "duplicate"
+	eventOutcomePermanentFailure = "permanent_failure"
+	eventOutcomeTransientFailure = "transient_failure"
+)
+
+// What happened to a ticket, see createOrUpdateZendeskTicket
+const (
+	ticketActionCreated = "created"
+	ticketActionUpdated = "updated"
+	ticketActionFailed  = "failed"
+)
+
+// Downstream services whose HTTP calls are measured
+const (
+	downstreamZendesk   = "zendesk"
+	downstreamDynatrace = "dynatrace"
+	downstreamWebhook   = "webhook"
+	// Keptn configuration service, zendesk.yaml and templates
+	downstreamConfigurationService = "configuration-service"
+)
+
+var (
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_received_total",
+		Help:      "Keptn events received, by event type.",
+	}, []string{"type"})
+
+	eventsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_processed_total",
+		Help:      "Keptn events processed, by event type and outcome (handled, duplicate, permanent_failure, transient_failure).",
+	}, []string{"type", "outcome"})
+
+	ticketsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tickets_total",
+		Help:      "Zendesk tickets created, updated or failed, by Keptn project, stage and task.",
+	}, []string{"project", "stage", "task", "action"})
+
+	ticketDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "ticket_duration_seconds",
+		Help:      "Time to create or update a Zendesk ticket, including lookups and retries.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"action"})
+
+	lastTicketTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_ticket_timestamp_seconds",
+		Help:      "Unix time of the last ticket that was created or updated successfully.",
+	})
+
+	downstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "downstream_request_duration_seconds",
+		Help:      "Duration of HTTP requests to Zendesk, Dynatrace and the webhook sink, by target, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"target", "method", "code"})
+
+	downstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "downstream_request_errors_total",
+		Help:      "HTTP requests to Zendesk, Dynatrace and the webhook sink that got no response (connection refused, timeouts, ...).",
+	}, []string{"target"})
+
+	zendeskRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "zendesk_retries_total",
+		Help:      "Zendesk calls retried after 429, 5xx or transport errors, by HTTP method.",
+	}, []string{"method"})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_reloads_total",
+		Help:      "Reloads of the configuration after the files in CONFIG_DIR changed, by result (success, failure).",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsReceived, eventsProcessed, ticketsTotal, ticketDuration, lastTicketTimestamp,
+		downstreamDuration, downstreamErrors, zendeskRetries, configReloads, stateCollector{})
+}
+
+// Counts an incoming event. Other than eventStats the metrics are broken down by event type
+func observeEventReceived(eventType string) {
+	eventsReceived.WithLabelValues(eventType).Inc()
+}
+
+func observeEventProcessed(eventType string, outcome string) {
+	eventsProcessed.WithLabelValues(eventType, outcome).Inc()
+}
+
+// Records the outcome of createOrUpdateZendeskTicket. Project, stage and task are taken from the labels of the ticket
+func observeTicket(ticket zendeskTicket, action string, start time.Time) {
+	project := labelValue(ticket.Labels, "keptn_project:")
+	stage := labelValue(ticket.Labels, "keptn_stage:")
+	task := labelValue(ticket.Labels, taskLabelPrefix)
+
+	ticketsTotal.WithLabelValues(project, stage, task, action).Inc()
+	ticketDuration.WithLabelValues(action).Observe(time.Since(start).Seconds())
+	if action != ticketActionFailed {
+		lastTicketTimestamp.SetToCurrentTime()
+	}
+}
+
+// Returns the value of the first label with the given prefix, e.g. keptn_project:
+func labelValue(labels []string, prefix string) string {
+	for _, label := range labels {
+		if strings.HasPrefix(label, prefix) {
+			return strings.TrimPrefix(label, prefix)
+		}
+	}
+	return ""
+}
+
+// Transport of all outgoing calls. go-utils switches off certificate verification on http.DefaultTransport
+// whenever it fetches a resource, so credentials must never travel through it. Cloned when the package
+// is initialized, i.e. before any resource is fetched, and with a TLS configuration of its own
+var outboundTransport = newOutboundTransport()
+
+func newOutboundTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return transport
+}
+
+// Returns an http.Client whose requests show up in downstream_request_duration_seconds and in the traces
+func instrumentedHTTPClient(target string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: instrumentedTransport(target, tracedTransport(target, outboundTransport))}
+}
+
+func instrumentedTransport(target string, next http.RoundTripper) http.RoundTripper {
+	observer := downstreamDuration.MustCurryWith(prometheus.Labels{"target": target})
+	errorCounter := downstreamErrors.WithLabelValues(target)
+	instrumented := promhttp.InstrumentRoundTripperDuration(observer, next)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := instrumented.RoundTrip(req)
+		if err != nil {
+			errorCounter.Inc()
+		}
+		return resp, err
+	})
+}
+
+// stateCollector reports state that is kept elsewhere at scrape time:
+// the Zendesk rate limit headroom, the sink counters and the outbox dead letters
+type stateCollector struct{}
+
+var (
+	rateLimitDesc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "zendesk", "rate_limit"),
+		"Requests per minute Zendesk allows, as last reported in X-Rate-Limit.", nil, nil)
+	rateLimitRemainingDesc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "zendesk", "rate_limit_remaining"),
+		"Requests left in the current minute, as last reported in X-Rate-Limit-Remaining.", nil, nil)
+	sinkNotificationsDesc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "sink_notifications_total"),
+		"Notifications sent to the sinks, by sink and outcome (sent, failed).", []string{"sink", "outcome"}, nil)
+	outboxDeadLettersDesc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "outbox_dead_letters_total"),
+		"Outbox items moved to the dead letters since the start of the service.", nil, nil)
+)
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rateLimitDesc
+	ch <- rateLimitRemainingDesc
+	ch <- sinkNotificationsDesc
+	ch <- outboxDeadLettersDesc
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	zendeskClientCache.Lock()
+	client := zendeskClientCache.client
+	zendeskClientCache.Unlock()
+
+	// Nothing to report until Zendesk sent rate limit headers
+	if client != nil {
+		if status := client.RateLimit(); status.Known {
+			ch <- prometheus.MustNewConstMetric(rateLimitDesc, prometheus.GaugeValue, float64(status.Limit))
+			ch <- prometheus.MustNewConstMetric(rateLimitRemainingDesc, prometheus.GaugeValue, float64(status.Remaining))
+		}
+	}
+
+	for _, sink := range notificationSinks {
+		name := sink.sink.Name()
+		ch <- prometheus.MustNewConstMetric(sinkNotificationsDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&sink.sent)), name, "sent")
+		ch <- prometheus.MustNewConstMetric(sinkNotificationsDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&sink.failed)), name, "failed")
+	}
+
+	if eventOutbox != nil {
+		ch <- prometheus.MustNewConstMetric(outboxDeadLettersDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&eventOutbox.deadLetters)))
+	}
+}
+
+// Serves /metrics, /healthz and /readyz on OPS_PORT. It stops when ctx is done
+func listenOps(ctx context.Context, port int, health *healthChecker) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.HandleFunc("/readyz", health.serveReadyz)
+	server := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: mux, ReadTimeout: 30 * time.Second, WriteTimeout: 30 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("Serving metrics and health checks", "port", port, "paths", "/metrics, /healthz, /readyz")
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
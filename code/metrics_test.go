@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestObserveTicket(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      []string
+		action      string
+		wantProject string
+		wantStage   string
+		wantTask    string
+		wantLast    bool
+	}{
+		{
+			name:        "created",
+			labels:      []string{"keptn_project:sockshop", "keptn_service:carts", "keptn_stage:production", "keptn_result:fail", "keptn_task:evaluation"},
+			action:      ticketActionCreated,
+			wantProject: "sockshop",
+			wantStage:   "production",
+			wantTask:    "evaluation",
+			wantLast:    true,
+		},
+		{
+			name:        "updated",
+			labels:      []string{"keptn_project:sockshop", "keptn_stage:staging", "keptn_task:deployment", "team-checkout"},
+			action:      ticketActionUpdated,
+			wantProject: "sockshop",
+			wantStage:   "staging",
+			wantTask:    "deployment",
+			wantLast:    true,
+		},
+		{
+			name:        "failed",
+			labels:      []string{"keptn_project:podtato", "keptn_stage:dev", "keptn_task:release"},
+			action:      ticketActionFailed,
+			wantProject: "podtato",
+			wantStage:   "dev",
+			wantTask:    "release",
+		},
+		{name: "without labels", action: ticketActionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := ticketsTotal.WithLabelValues(tt.wantProject, tt.wantStage, tt.wantTask, tt.action)
+			before := testutil.ToFloat64(counter)
+			lastTicketTimestamp.Set(0)
+
+			observeTicket(zendeskTicket{Labels: tt.labels}, tt.action, time.Now())
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("tickets_total{project=%q,stage=%q,task=%q,action=%q} grew by %v, want 1", tt.wantProject, tt.wantStage, tt.wantTask, tt.action, got)
+			}
+			if last := testutil.ToFloat64(lastTicketTimestamp); (last != 0) != tt.wantLast {
+				t.Errorf("last_ticket_timestamp_seconds = %v, want set %v", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestInstrumentedTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		down     bool
+		wantCode string
+	}{
+		{name: "ok", status: http.StatusOK, wantCode: "200"},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantCode: "429"},
+		{name: "no response", down: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			if tt.down {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+			// Every case measures a target of its own
+			target := "test-" + strings.ReplaceAll(tt.name, " ", "-")
+			client := instrumentedHTTPClient(target, time.Second)
+
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.down {
+				t.Fatalf("Get() error = %v, want error %v", err, tt.down)
+			}
+
+			if errors := testutil.ToFloat64(downstreamErrors.WithLabelValues(target)); (errors == 1) != tt.down {
+				t.Errorf("downstream_request_errors_total{target=%q} = %v, want error %v", target, errors, tt.down)
+			}
+			if tt.down {
+				return
+			}
+			metric := &dto.Metric{}
+			if err := downstreamDuration.WithLabelValues(target, "get", tt.wantCode).(prometheus.Histogram).Write(metric); err != nil {
+				t.Fatal(err)
+			}
+			if count := metric.GetHistogram().GetSampleCount(); count != 1 {
+				t.Errorf("downstream_request_duration_seconds{target=%q,code=%q} has %d samples, want 1", target, tt.wantCode, count)
+			}
+		})
+	}
+}
+
+func TestStateCollectorSinks(t *testing.T) {
+	sinks := notificationSinks
+	defer func() { notificationSinks = sinks }()
+
+	tests := []struct {
+		name  string
+		sinks []*activeSink
+		want  string
+	}{
+		{name: "no sinks"},
+		{
+			name:  "counters per sink",
+			sinks: []*activeSink{{sink: &failingSink{}, sent: 3, failed: 1}},
+			want: `
+# HELP zendesk_service_sink_notifications_total Notifications sent to the sinks, by sink and outcome (sent, failed).
+# TYPE zendesk_service_sink_notifications_total counter
+zendesk_service_sink_notifications_total{outcome="failed",sink="failing"} 1
+zendesk_service_sink_notifications_total{outcome="sent",sink="failing"} 3
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notificationSinks = tt.sinks
+			if err := testutil.CollectAndCompare(stateCollector{}, strings.NewReader(tt.want), "zendesk_service_sink_notifications_total"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
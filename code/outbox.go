@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+)
+
+// Subdirectories of OUTBOX_DIR
+const (
+	outboxPendingDir = "pending"
+	outboxDeadDir    = "dead"
+)
+
+// outboxItem is an incoming event waiting to be turned into a ticket. Each item is one JSON file
+type outboxItem struct {
+	ID          string            `json:"id"`
+	Event       cloudevents.Event `json:"event"`
+	Attempts    int               `json:"attempts"`
+	NextAttempt time.Time         `json:"nextAttempt"`
+	LastError   string            `json:"lastError,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+}
+
+// outbox persists incoming events in OUTBOX_DIR/pending before they are acknowledged
+// A background worker (run) drains them to Zendesk and the sinks. Items that fail permanently,
+// or still fail after maxAttempts, are moved to OUTBOX_DIR/dead where they can be inspected and replayed
+type outbox struct {
+	dir          string
+	maxAttempts  int
+	pollInterval time.Duration
+
+	// handle processes one event, i.e. handleKeptnCloudEvent. nil for the outbox CLI
+	handle func(ctx context.Context, event cloudevents.Event) error
+	// wakeup lets the worker pick up new items without waiting for the next poll
+	wakeup chan struct{}
+	// mu serializes file operations of the receiver and the worker
+	mu sync.Mutex
+
+	deadLetters uint64
+}
+
+// The outbox, if OUTBOX_DIR is set. Without an outbox events are handled synchronously
+var eventOutbox *outbox
+
+func newOutbox(dir string, maxAttempts int, pollInterval time.Duration, handle func(ctx context.Context, event cloudevents.Event) error) (*outbox, error) {
+	for _, sub := range []string{outboxPendingDir, outboxDeadDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("could not create outbox directory: %w", err)
+		}
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+
+	return &outbox{
+		dir:          dir,
+		maxAttempts:  maxAttempts,
+		pollInterval: pollInterval,
+		handle:       handle,
+		wakeup:       make(chan struct{}, 1),
+	}, nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// enqueue persists an event. Once it returns without error the event may be acknowledged
+func (o *outbox) enqueue(event cloudevents.Event) error {
+	now := time.Now().UTC()
+	item := &outboxItem{
+		// Item IDs sort by arrival, so the worker keeps the order of the events
+		ID:          fmt.Sprintf("%d-%s", now.UnixNano(), unsafeFileNameChars.ReplaceAllString(event.ID(), "_")),
+		Event:       event,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+
+	o.mu.Lock()
+	err := o.write(outboxPendingDir, item)
+	o.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case o.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run drains the pending items until ctx is done
+func (o *outbox) run(ctx context.Context) {
+	slog.InfoContext(ctx, "Draining outbox", "dir", o.dir, "maxAttempts", o.maxAttempts)
+
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		o.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wakeup:
+		}
+	}
+}
+
+// drain processes all pending items that are due, oldest first
+func (o *outbox) drain(ctx context.Context) {
+	items, err := o.list(outboxPendingDir)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not list pending items", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if item.NextAttempt.After(now) {
+			continue
+		}
+		o.process(ctx, item)
+	}
+}
+
+func (o *outbox) process(ctx context.Context, item *outboxItem) {
+	ctx = withEventLogFields(ctx, item.Event)
+	item.Attempts++
+	err := o.handleSafely(ctx, item)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err == nil {
+		atomic.AddUint64(&eventStats.handled, 1)
+		observeEventProcessed(item.Event.Type(), eventOutcomeHandled)
+		if err := os.Remove(o.path(outboxPendingDir, item.ID)); err != nil {
+			slog.ErrorContext(ctx, "Could not remove handled item", "item", item.ID, "error", err)
+		}
+		return
+	}
+
+	item.LastError = err.Error()
+
+	if isPermanent(err) || item.Attempts >= o.maxAttempts {
+		atomic.AddUint64(&eventStats.permanentFailures, 1)
+		observeEventProcessed(item.Event.Type(), eventOutcomePermanentFailure)
+		deadLetters := atomic.AddUint64(&o.deadLetters, 1)
+		slog.ErrorContext(ctx, "Moving item to the dead letters", "item", item.ID, "attempts", item.Attempts, "error", err,
+			"stats", eventStats.String(), "deadLetters", deadLetters)
+		if err := o.write(outboxDeadDir, item); err != nil {
+			slog.ErrorContext(ctx, "Could not write dead letter", "item", item.ID, "error", err)
+			return
+		}
+		if err := os.Remove(o.path(outboxPendingDir, item.ID)); err != nil {
+			slog.ErrorContext(ctx, "Could not remove dead item", "item", item.ID, "error", err)
+		}
+		return
+	}
+
+	atomic.AddUint64(&eventStats.transientFailures, 1)
+	observeEventProcessed(item.Event.Type(), eventOutcomeTransientFailure)
+	item.NextAttempt = time.Now().Add(outboxBackoff(item.Attempts))
+	slog.WarnContext(ctx, "Item failed, retrying later", "item", item.ID, "attempt", item.Attempts, "maxAttempts", o.maxAttempts,
+		"nextAttempt", item.NextAttempt.Format(time.RFC3339), "error", err)
+	if err := o.write(outboxPendingDir, item); err != nil {
+		slog.ErrorContext(ctx, "Could not update item", "item", item.ID, "error", err)
+	}
+}
+
+// Calls the handler for the event of item. A panic is turned into a permanent error, so the item goes
+// to the dead letters instead of crashing the service on every restart while it is pending
+func (o *outbox) handleSafely(ctx context.Context, item *outboxItem) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "Panic while handling item", "item", item.ID, "panic", r, "stack", string(debug.Stack()))
+			err = permanentError(fmt.Errorf("panic while handling event: %v", r))
+		}
+	}()
+	return o.handle(ctx, item.Event)
+}
+
+// Exponential backoff between attempts: 10s, 20s, 40s, ... capped at 15 minutes
+func outboxBackoff(attempts int) time.Duration {
+	wait := 10 * time.Second
+	for i := 1; i < attempts && wait < 15*time.Minute; i++ {
+		wait *= 2
+	}
+	if wait > 15*time.Minute {
+		wait = 15 * time.Minute
+	}
+	return wait
+}
+
+// replay moves a dead letter back to pending with a fresh attempt count
+func (o *outbox) replay(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	item, err := o.read(outboxDeadDir, id)
+	if err != nil {
+		return err
+	}
+	item.Attempts = 0
+	item.NextAttempt = time.Now().UTC()
+	item.LastError = ""
+
+	if err := o.write(outboxPendingDir, item); err != nil {
+		return err
+	}
+	return os.Remove(o.path(outboxDeadDir, id))
+}
+
+// list returns the items of a subdirectory ordered by ID, i.e. by arrival
+func (o *outbox) list(sub string) ([]*outboxItem, error) {
+	files, err := ioutil.ReadDir(filepath.Join(o.dir, sub))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+
+	items := []*outboxItem{}
+	for _, id := range ids {
+		item, err := o.read(sub, id)
+		if err != nil {
+			slog.Warn("Skipping unreadable item", "area", sub, "item", id, "error", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (o *outbox) path(sub string, id string) string {
+	return filepath.Join(o.dir, sub, id+".json")
+}
+
+func (o *outbox) read(sub string, id string) (*outboxItem, error) {
+	content, err := ioutil.ReadFile(o.path(sub, id))
+	if err != nil {
+		return nil, err
+	}
+	item := &outboxItem{}
+	if err := json.Unmarshal(content, item); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", id, err)
+	}
+	return item, nil
+}
+
+// write stores an item via a temporary file and a rename, so that a crash never leaves a half written item
+func (o *outbox) write(sub string, item *outboxItem) error {
+	content, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode item %s: %w", item.ID, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Join(o.dir, sub), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path(sub, item.ID))
+}
+
+// runOutboxCommand implements the outbox CLI for operators, e.g. kubectl exec ... -- /zendesk-service outbox list dead
+//
+//	outbox list [pending|dead]   lists the items (default: dead)
+//	outbox show <id>             prints a dead letter incl. its event and last error
+//	outbox replay <id>|all       moves dead letters back to pending
+func runOutboxCommand(args []string, env envConfig) int {
+	if env.OutboxDir == "" {
+		slog.Error("OUTBOX_DIR is not set")
+		return 1
+	}
+	// The CLI only moves items around, the running service handles them
+	o, err := newOutbox(env.OutboxDir, env.OutboxMaxAttempts, env.OutboxPollInterval, nil)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: outbox list [pending|dead] | show <id> | replay <id>|all")
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		sub := outboxDeadDir
+		if len(args) > 1 {
+			sub = args[1]
+		}
+		if sub != outboxPendingDir && sub != outboxDeadDir {
+			fmt.Fprintf(os.Stderr, "unknown outbox area %q, use pending or dead\n", sub)
+			return 2
+		}
+		items, err := o.list(sub)
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		for _, item := range items {
+			fmt.Printf("%s\t%s\t%s\tattempts=%d\t%s\n", item.ID, item.Event.Type(), item.Event.ID(), item.Attempts, item.LastError)
+		}
+		return 0
+
+	case "show":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: outbox show <id>")
+			return 2
+		}
+		content, err := ioutil.ReadFile(o.path(outboxDeadDir, args[1]))
+		if err != nil {
+			slog.Error(err.Error())
+			return 1
+		}
+		fmt.Println(string(content))
+		return 0
+
+	case "replay":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: outbox replay <id>|all")
+			return 2
+		}
+		ids := args[1:]
+		if args[1] == "all" {
+			items, err := o.list(outboxDeadDir)
+			if err != nil {
+				slog.Error(err.Error())
+				return 1
+			}
+			ids = []string{}
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+		}
+		failed := 0
+		for _, id := range ids {
+			if err := o.replay(id); err != nil {
+				slog.Error("Could not replay item", "item", id, "error", err)
+				failed++
+				continue
+			}
+			fmt.Println("replayed", id)
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown outbox command %q\n", args[0])
+	return 2
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// Returns a Keptn event of sockshop/production/carts
+func newTestEvent(t *testing.T, eventType string, data interface{}) cloudevents.Event {
+	t.Helper()
+	event := cloudevents.NewEvent()
+	event.SetID("event-1")
+	event.SetSource("test")
+	event.SetType(eventType)
+	event.SetExtension("shkeptncontext", "ctx-1")
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// Handles events with handleKeptnCloudEvent and the memory idempotency store. Resources are read from the
+// working directory, which has no zendesk.yaml
+func useTestIdempotencyStore(t *testing.T) {
+	t.Helper()
+	store, options := processedEvents, keptnOptions
+	processedEvents = newMemoryIdempotencyStore(time.Hour, 0)
+	keptnOptions.UseLocalFileSystem = true
+	t.Cleanup(func() { processedEvents, keptnOptions = store, options })
+}
+
+func TestOutboxReplaysPanickedEvent(t *testing.T) {
+	useTestIdempotencyStore(t)
+
+	// Handlers dereference the configuration, without one they panic
+	var cfg *Config
+	handled := 0
+	o, err := newOutbox(t.TempDir(), 3, time.Minute, func(ctx context.Context, event cloudevents.Event) error {
+		handled++
+		return handleKeptnCloudEvent(ctx, cfg, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := newTestEvent(t, keptnv2.GetFinishedEventType(keptnv2.EvaluationTaskName), keptnv2.EvaluationFinishedEventData{
+		EventData: keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts", Result: keptnv2.ResultFailed},
+	})
+	if err := o.enqueue(event); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		o.drain(context.Background())
+
+		dead, err := o.list(outboxDeadDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if handled != attempt {
+			t.Fatalf("attempt %d: handler ran %d times", attempt, handled)
+		}
+		if len(dead) != 1 || !strings.Contains(dead[0].LastError, "panic while handling event") {
+			t.Fatalf("attempt %d: dead letters = %+v, want the panicked event", attempt, dead)
+		}
+		if err := o.replay(dead[0].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
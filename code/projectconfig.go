@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"gopkg.in/yaml.v2"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// Name of the resource in the Keptn configuration repo
+const zendeskConfigResource = "zendesk.yaml"
+
+// Versions of zendesk.yaml this service understands
+const zendeskConfigVersionV1 = "v1"
+
+// APIs tickets can be created with, see TicketSettings.API
+const (
+	// End-user Requests API (/api/v2/requests.json). The other fields are set by a second call, which needs an agent
+	ticketAPIRequests = "requests"
+	// Agent Tickets API (/api/v2/tickets.json), which sets all fields at once
+	ticketAPITickets = "tickets"
+)
+
+// Visibility of the comments the service adds, see TicketSettings.Comments
+const (
+	commentsPublic  = "public"
+	commentsPrivate = "private"
+)
+
+// ZendeskConfig is the content of zendesk.yaml. It lets every project, stage or service
+// decide which events open tickets and how these tickets are routed, e.g.
+//
+//	version: v1
+//	defaults:
+//	  api: tickets
+//	  priority: normal
+//	  groupId: 360001234567
+//	  assigneeId: 360007654321
+//	  customFields:
+//	    - id: 360012345678
+//	      value: checkout
+//	  comments: private
+//	  tags: ["team-checkout"]
+//	events:
+//	  evaluation:
+//	    results: ["fail", "warning"]
+//	    priority: high
+//	    template:
+//	      subject: "Quality gate {{.Result}} for {{.Service}} in {{.Stage}}"
+//	      bodyResource: zendesk/evaluation.html
+//	  remediation:
+//	    enabled: false
+//	rules:
+//	  - name: production failures
+//	    match: {stages: ["production"], results: ["fail"]}
+//	    set: {priority: urgent, type: incident}
+type ZendeskConfig struct {
+	Version  string                    `yaml:"version"`
+	Defaults TicketSettings            `yaml:"defaults"`
+	Events   map[string]TicketSettings `yaml:"events"`
+	// Rules shape the tickets of evaluations and remediations, see TicketRule
+	Rules []TicketRule `yaml:"rules,omitempty"`
+}
+
+// TicketSettings control the tickets for one Keptn task (evaluation, remediation, ...)
+type TicketSettings struct {
+	// Enabled overrides the ZENDESK_TICKET_FOR_* env vars when set
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// Results restricts tickets to events with one of these results (pass, warning, fail). Empty means all results
+	Results []string `yaml:"results,omitempty"`
+	// Priority is one of low, normal, high, urgent
+	Priority string `yaml:"priority,omitempty"`
+	// GroupID is the Zendesk group the ticket is assigned to
+	GroupID int64    `yaml:"groupId,omitempty"`
+	Tags    []string `yaml:"tags,omitempty"`
+	// API is requests (default) or tickets, see ticketAPIRequests
+	API string `yaml:"api,omitempty"`
+	// Type is one of problem, incident, question or task
+	Type string `yaml:"type,omitempty"`
+	// AssigneeID is the agent new tickets are assigned to
+	AssigneeID int64 `yaml:"assigneeId,omitempty"`
+	// CustomFields are set on new tickets
+	CustomFields []CustomFieldSetting `yaml:"customFields,omitempty"`
+	// Comments is public (default) or private, i.e. internal notes only agents see
+	Comments string `yaml:"comments,omitempty"`
+	// Template overrides the built-in subject and body templates
+	Template TemplateSettings `yaml:"template,omitempty"`
+}
+
+// CustomFieldSetting is the value of a Zendesk ticket field: a string, number or boolean, or a list for multi-select fields
+type CustomFieldSetting struct {
+	ID    int64       `yaml:"id"`
+	Value interface{} `yaml:"value"`
+}
+
+var validPriorities = map[string]bool{"": true, "low": true, "normal": true, "high": true, "urgent": true}
+
+var validTicketTypes = map[string]bool{"": true, "problem": true, "incident": true, "question": true, "task": true}
+
+// Validate checks the version and the values of zendesk.yaml
+func (c *ZendeskConfig) Validate() error {
+	if c.Version != zendeskConfigVersionV1 {
+		return fmt.Errorf("unsupported version %q, expected %q", c.Version, zendeskConfigVersionV1)
+	}
+	if err := c.Defaults.validate(); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	for taskName, settings := range c.Events {
+		if err := settings.validate(); err != nil {
+			return fmt.Errorf("events.%s: %w", taskName, err)
+		}
+	}
+	for i, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rules[%d] %s: %w", i, rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s TicketSettings) validate() error {
+	if !validPriorities[s.Priority] {
+		return fmt.Errorf("invalid priority %q", s.Priority)
+	}
+	for _, result := range s.Results {
+		switch keptnv2.ResultType(result) {
+		case keptnv2.ResultPass, keptnv2.ResultWarning, keptnv2.ResultFailed:
+		default:
+			return fmt.Errorf("invalid result %q", result)
+		}
+	}
+	switch s.API {
+	case "", ticketAPIRequests, ticketAPITickets:
+	default:
+		return fmt.Errorf("invalid api %q, expected %s or %s", s.API, ticketAPIRequests, ticketAPITickets)
+	}
+	if !validTicketTypes[s.Type] {
+		return fmt.Errorf("invalid type %q", s.Type)
+	}
+	switch s.Comments {
+	case "", commentsPublic, commentsPrivate:
+	default:
+		return fmt.Errorf("invalid comments %q, expected %s or %s", s.Comments, commentsPublic, commentsPrivate)
+	}
+	for _, field := range s.CustomFields {
+		if field.ID <= 0 {
+			return fmt.Errorf("custom field without id")
+		}
+		if !isScalar(field.Value) {
+			list, ok := field.Value.([]interface{})
+			if !ok {
+				return fmt.Errorf("custom field %d: value must be a string, number, boolean or list", field.ID)
+			}
+			for _, item := range list {
+				if !isScalar(item) {
+					return fmt.Errorf("custom field %d: list items must be strings, numbers or booleans", field.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Values YAML and JSON agree on
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+// SettingsFor returns the settings for a Keptn task, i.e. the defaults overridden by the task specific settings
+// A nil config (no zendesk.yaml) returns empty settings
+func (c *ZendeskConfig) SettingsFor(taskName string) TicketSettings {
+	if c == nil {
+		return TicketSettings{}
+	}
+
+	settings := c.Defaults
+	settings.Tags = append([]string{}, c.Defaults.Tags...)
+
+	override, ok := c.Events[taskName]
+	if !ok {
+		return settings
+	}
+	if override.Enabled != nil {
+		settings.Enabled = override.Enabled
+	}
+	if len(override.Results) > 0 {
+		settings.Results = override.Results
+	}
+	if override.Priority != "" {
+		settings.Priority = override.Priority
+	}
+	if override.GroupID != 0 {
+		settings.GroupID = override.GroupID
+	}
+	settings.Tags = append(settings.Tags, override.Tags...)
+	if override.API != "" {
+		settings.API = override.API
+	}
+	if override.Type != "" {
+		settings.Type = override.Type
+	}
+	if override.AssigneeID != 0 {
+		settings.AssigneeID = override.AssigneeID
+	}
+	settings.CustomFields = mergeCustomFields(settings.CustomFields, override.CustomFields)
+	if override.Comments != "" {
+		settings.Comments = override.Comments
+	}
+	if override.Template.Subject != "" {
+		settings.Template.Subject = override.Template.Subject
+	}
+	if override.Template.Body != "" || override.Template.BodyResource != "" {
+		settings.Template.Body = override.Template.Body
+		settings.Template.BodyResource = override.Template.BodyResource
+	}
+	return settings
+}
+
+// Fields of the task override the defaults with the same id
+func mergeCustomFields(defaults []CustomFieldSetting, overrides []CustomFieldSetting) []CustomFieldSetting {
+	merged := []CustomFieldSetting{}
+	for _, field := range defaults {
+		overridden := false
+		for _, override := range overrides {
+			overridden = overridden || override.ID == field.ID
+		}
+		if !overridden {
+			merged = append(merged, field)
+		}
+	}
+	return append(merged, overrides...)
+}
+
+// Returns the configured type, or fallback if there is none
+func (s TicketSettings) ticketType(fallback string) string {
+	if s.Type != "" {
+		return s.Type
+	}
+	return fallback
+}
+
+// Returns the fields of a ticket only the agent Tickets API can set
+func (s TicketSettings) agentFields() agentTicketFields {
+	fields := agentTicketFields{
+		UseTicketsAPI:   s.API == ticketAPITickets,
+		AssigneeID:      s.AssigneeID,
+		PrivateComments: s.Comments == commentsPrivate,
+	}
+	for _, field := range s.CustomFields {
+		fields.CustomFields = append(fields.CustomFields, zendesk.CustomField{ID: field.ID, Value: field.Value})
+	}
+	return fields
+}
+
+// IsEnabled reports whether tickets are wanted for the task at all
+// enabledByDefault is the value of the matching ZENDESK_TICKET_FOR_* env var
+func (s TicketSettings) IsEnabled(enabledByDefault bool) bool {
+	if s.Enabled != nil {
+		return *s.Enabled
+	}
+	return enabledByDefault
+}
+
+// MatchesResult reports whether an event with the given result should open or update a ticket
+func (s TicketSettings) MatchesResult(result string) bool {
+	if len(s.Results) == 0 {
+		return true
+	}
+	for _, wanted := range s.Results {
+		if wanted == result {
+			return true
+		}
+	}
+	return false
+}
+
+// Loads zendesk.yaml for the project / stage / service of the incoming event
+// The most specific resource wins: service level, then stage level, then project level
+// Returns nil if there is no (valid) zendesk.yaml, in which case the env vars apply
+func loadZendeskConfig(ctx context.Context, myKeptn *keptnv2.Keptn) *ZendeskConfig {
+	content, location, err := fetchKeptnResource(myKeptn, zendeskConfigResource)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not fetch "+zendeskConfigResource+". Falling back to env vars", "error", err)
+		return nil
+	}
+	if content == nil {
+		return nil
+	}
+
+	config := &ZendeskConfig{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		slog.WarnContext(ctx, "Could not parse "+zendeskConfigResource+". Falling back to env vars", "location", location, "error", err)
+		return nil
+	}
+	if err := config.Validate(); err != nil {
+		slog.WarnContext(ctx, "Invalid "+zendeskConfigResource+". Falling back to env vars", "location", location, "error", err)
+		return nil
+	}
+
+	slog.DebugContext(ctx, "Using "+zendeskConfigResource, "location", location)
+	return config
+}
+
+// Returns the content of the most specific version of a resource and where it was found
+// Returns nil content if the resource does not exist on any level
+func fetchKeptnResource(myKeptn *keptnv2.Keptn, resourceURI string) ([]byte, string, error) {
+	// In local mode the file is read from the working directory
+	if myKeptn.UseLocalFileSystem {
+		content, err := ioutil.ReadFile(resourceURI)
+		if err != nil {
+			return nil, "", nil
+		}
+		return content, "local file system", nil
+	}
+
+	project := myKeptn.Event.GetProject()
+	stage := myKeptn.Event.GetStage()
+	service := myKeptn.Event.GetService()
+
+	if project == "" {
+		return nil, "", nil
+	}
+
+	if stage != "" && service != "" {
+		resource, err := myKeptn.ResourceHandler.GetServiceResource(project, stage, service, resourceURI)
+		if err == nil {
+			return []byte(resource.ResourceContent), "service " + project + "/" + stage + "/" + service, nil
+		} else if err != api.ResourceNotFoundError {
+			return nil, "", err
+		}
+	}
+
+	if stage != "" {
+		resource, err := myKeptn.ResourceHandler.GetStageResource(project, stage, resourceURI)
+		if err == nil {
+			return []byte(resource.ResourceContent), "stage " + project + "/" + stage, nil
+		} else if err != api.ResourceNotFoundError {
+			return nil, "", err
+		}
+	}
+
+	resource, err := myKeptn.ResourceHandler.GetProjectResource(project, resourceURI)
+	if err == nil {
+		return []byte(resource.ResourceContent), "project " + project, nil
+	} else if err != api.ResourceNotFoundError {
+		return nil, "", err
+	}
+
+	return nil, "", nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"gopkg.in/yaml.v2"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// Returns a Keptn handler for an evaluation whose resources come from configurationService
+func testKeptnHandler(t *testing.T, configurationService string, data keptnv2.EventData) *keptnv2.Keptn {
+	t.Helper()
+	options := keptnOptions
+	keptnOptions.ConfigurationServiceURL = configurationService
+	t.Cleanup(func() { keptnOptions = options })
+
+	event := newTestEvent(t, keptnv2.GetFinishedEventType(keptnv2.EvaluationTaskName), data)
+	myKeptn, err := newKeptnHandler(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return myKeptn
+}
+
+func TestOutboundTransportVerifiesCertificatesAfterResourceFetch(t *testing.T) {
+	configurationService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Content is base64 encoded, "version: v1"
+		w.Write([]byte(`{"resourceURI":"zendesk.yaml","resourceContent":"dmVyc2lvbjogdjE="}`))
+	}))
+	defer configurationService.Close()
+	zendeskAPI := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer zendeskAPI.Close()
+
+	myKeptn := testKeptnHandler(t, configurationService.URL, keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts"})
+	if myKeptn.ResourceHandler.HTTPClient != configurationServiceHTTPClient {
+		t.Error("the resource handler does not use configurationServiceHTTPClient")
+	}
+	if content, _, err := fetchKeptnResource(myKeptn, zendeskConfigResource); err != nil || string(content) != "version: v1" {
+		t.Fatalf("fetchKeptnResource() = %q, %v", content, err)
+	}
+
+	// go-utils has switched off verification on http.DefaultTransport by now
+	resp, err := instrumentedHTTPClient(downstreamZendesk, 0).Get(zendeskAPI.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a server with an untrusted certificate succeeded")
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("error = %v, want a certificate verification error", err)
+	}
+}
+
+// fakeConfigurationService serves the given resources by path, e.g.
+// /v1/project/sockshop/stage/production/resource/zendesk.yaml
+func fakeConfigurationService(t *testing.T, resources map[string]string, status int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		content, ok := resources[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"resourceURI": zendeskConfigResource, "resourceContent": base64.StdEncoding.EncodeToString([]byte(content))})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchKeptnResource(t *testing.T) {
+	const (
+		serviceResource = "/v1/project/sockshop/stage/production/service/carts/resource/zendesk.yaml"
+		stageResource   = "/v1/project/sockshop/stage/production/resource/zendesk.yaml"
+		projectResource = "/v1/project/sockshop/resource/zendesk.yaml"
+	)
+	all := map[string]string{serviceResource: "service", stageResource: "stage", projectResource: "project"}
+	sequence := keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts"}
+
+	tests := []struct {
+		name         string
+		resources    map[string]string
+		status       int
+		data         keptnv2.EventData
+		wantContent  string
+		wantLocation string
+		wantErr      bool
+	}{
+		{name: "service wins", resources: all, data: sequence, wantContent: "service", wantLocation: "service sockshop/production/carts"},
+		{
+			name:         "stage",
+			resources:    map[string]string{stageResource: "stage", projectResource: "project"},
+			data:         sequence,
+			wantContent:  "stage",
+			wantLocation: "stage sockshop/production",
+		},
+		{name: "project", resources: map[string]string{projectResource: "project"}, data: sequence, wantContent: "project", wantLocation: "project sockshop"},
+		{name: "none", data: sequence},
+		{name: "event without service", resources: all, data: keptnv2.EventData{Project: "sockshop", Stage: "production"}, wantContent: "stage", wantLocation: "stage sockshop/production"},
+		{name: "event without stage", resources: all, data: keptnv2.EventData{Project: "sockshop", Service: "carts"}, wantContent: "project", wantLocation: "project sockshop"},
+		{name: "event without project", resources: all, data: keptnv2.EventData{Stage: "production", Service: "carts"}},
+		{name: "configuration service fails", status: http.StatusInternalServerError, data: sequence, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakeConfigurationService(t, tt.resources, tt.status)
+			myKeptn := testKeptnHandler(t, server.URL, tt.data)
+
+			content, location, err := fetchKeptnResource(myKeptn, zendeskConfigResource)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchKeptnResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(content) != tt.wantContent || location != tt.wantLocation {
+				t.Errorf("fetchKeptnResource() = %q, %q, want %q, %q", content, location, tt.wantContent, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestLoadZendeskConfig(t *testing.T) {
+	const stageResource = "/v1/project/sockshop/stage/production/resource/zendesk.yaml"
+
+	tests := []struct {
+		name    string
+		content string
+		status  int
+		wantNil bool
+	}{
+		{name: "valid", content: "version: v1\n"},
+		{name: "missing", wantNil: true},
+		{name: "unknown field", content: "version: v1\nticket: {}\n", wantNil: true},
+		{name: "unknown version", content: "version: v2\n", wantNil: true},
+		{name: "configuration service fails", status: http.StatusInternalServerError, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := map[string]string{}
+			if tt.content != "" {
+				resources[stageResource] = tt.content
+			}
+			server := fakeConfigurationService(t, resources, tt.status)
+			myKeptn := testKeptnHandler(t, server.URL, keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts"})
+
+			if config := loadZendeskConfig(context.Background(), myKeptn); (config == nil) != tt.wantNil {
+				t.Errorf("loadZendeskConfig() = %+v, want nil %v", config, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestAgentTicketFields(t *testing.T) {
+	const defaults = `
+version: v1
+defaults:
+  api: tickets
+  assigneeId: 360007654321
+  customFields:
+    - id: 1
+      value: checkout
+    - id: 2
+      value: [eu, us]
+  comments: private
+`
+
+	tests := []struct {
+		name    string
+		content string
+		task    string
+		want    agentTicketFields
+		wantErr string
+	}{
+		{name: "requests API by default", content: "version: v1\n", task: keptnv2.EvaluationTaskName},
+		{
+			name:    "defaults",
+			content: defaults,
+			task:    keptnv2.EvaluationTaskName,
+			want: agentTicketFields{
+				UseTicketsAPI:   true,
+				AssigneeID:      360007654321,
+				CustomFields:    []zendesk.CustomField{{ID: 1, Value: "checkout"}, {ID: 2, Value: []interface{}{"eu", "us"}}},
+				PrivateComments: true,
+			},
+		},
+		{
+			name:    "task overrides",
+			content: defaults + "events:\n  release:\n    api: requests\n    assigneeId: 42\n    customFields: [{id: 1, value: payments}, {id: 3, value: true}]\n    comments: public\n",
+			task:    keptnv2.ReleaseTaskName,
+			want: agentTicketFields{
+				AssigneeID:   42,
+				CustomFields: []zendesk.CustomField{{ID: 2, Value: []interface{}{"eu", "us"}}, {ID: 1, Value: "payments"}, {ID: 3, Value: true}},
+			},
+		},
+		{name: "invalid api", content: "version: v1\ndefaults:\n  api: graphql\n", wantErr: "invalid api"},
+		{name: "invalid comments", content: "version: v1\nevents:\n  test:\n    comments: internal\n", wantErr: "events.test: invalid comments"},
+		{name: "custom field without id", content: "version: v1\ndefaults:\n  customFields: [{value: checkout}]\n", wantErr: "custom field without id"},
+		{name: "custom field with an object", content: "version: v1\ndefaults:\n  customFields: [{id: 1, value: {team: checkout}}]\n", wantErr: "must be a string, number, boolean or list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ZendeskConfig{}
+			if err := yaml.UnmarshalStrict([]byte(tt.content), config); err != nil {
+				t.Fatal(err)
+			}
+			err := config.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+
+			if got := config.SettingsFor(tt.task).agentFields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("agentFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
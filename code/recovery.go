@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+// Recovery policies (ZENDESK_RECOVERY_POLICY) for tickets of failed evaluations
+// once a later evaluation of the same project / stage / service passes
+const (
+	recoveryPolicySolve   = "solve"   // comment and move the ticket to solved
+	recoveryPolicyComment = "comment" // comment only, leave the status to the agent
+	recoveryPolicyLeave   = "leave"   // do not touch the ticket
+)
+
+// Tag added to recovered tickets so that they are only recovered once
+const recoveredLabel = "keptn_recovered"
+
+func isValidRecoveryPolicy(policy string) bool {
+	return policy == recoveryPolicySolve || policy == recoveryPolicyComment || policy == recoveryPolicyLeave
+}
+
+// Finds the unsolved tickets of failed or warning evaluations for the project / stage / service
+// of a passing evaluation and applies the recovery policy to them
+// Searching and updating the tickets needs an agent. End users are refused, which the readiness check reports
+func resolveRecoveredTickets(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.EvaluationFinishedEventData) error {
+	if cfg.Zendesk.RecoveryPolicy == recoveryPolicyLeave {
+		return nil
+	}
+
+	client, err := newZendeskClient(cfg.Zendesk)
+	if err != nil {
+		return err
+	}
+
+	// Zendesk labels don't accept spaces, they were converted to dashes when the ticket was created
+	wantedLabels := []string{
+		"keptn_project:" + strings.ReplaceAll(data.EventData.GetProject(), " ", "-"),
+		"keptn_stage:" + strings.ReplaceAll(data.EventData.GetStage(), " ", "-"),
+		"keptn_service:" + strings.ReplaceAll(data.EventData.GetService(), " ", "-"),
+	}
+
+	query := "status<solved"
+	for _, label := range wantedLabels {
+		query += fmt.Sprintf(" tags:%q", label)
+	}
+
+	tickets, err := client.SearchTickets(ctx, query)
+	if zendesk.IsForbidden(err) {
+		slog.WarnContext(ctx, "Searching tickets is not permitted for this Zendesk user. Cannot resolve recovered tickets without an agent",
+			"policy", cfg.Zendesk.RecoveryPolicy)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	comment := recoveryComment(cfg, myKeptn, data)
+	for _, ticket := range tickets {
+		if !isRecoverable(ticket, wantedLabels) {
+			continue
+		}
+
+		update := &zendesk.Ticket{
+			Comment:        &zendesk.Comment{Body: comment},
+			AdditionalTags: []string{recoveredLabel},
+		}
+		if cfg.Zendesk.RecoveryPolicy == recoveryPolicySolve {
+			update.Status = zendesk.StatusSolved
+		}
+
+		if _, err := client.UpdateTicket(ctx, ticket.ID, update); err != nil {
+			slog.WarnContext(ctx, "Could not update recovered ticket", "ticketID", ticket.ID, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Applied recovery policy", "policy", cfg.Zendesk.RecoveryPolicy, "ticketID", ticket.ID)
+	}
+
+	return nil
+}
+
+// A ticket is recoverable if it carries all of the wanted labels, was last
+// updated for a failed or warning result and has not been recovered before
+// Tickets of other tasks (e.g. failed deployments) are left alone
+// Search results are checked again as Zendesk matches tags loosely
+func isRecoverable(ticket zendesk.Ticket, wantedLabels []string) bool {
+	tags := map[string]bool{}
+	for _, tag := range ticket.Tags {
+		tags[tag] = true
+		if strings.HasPrefix(tag, taskLabelPrefix) && tag != taskLabelPrefix+keptnv2.EvaluationTaskName {
+			return false
+		}
+	}
+
+	for _, label := range wantedLabels {
+		if !tags[label] {
+			return false
+		}
+	}
+
+	failed := tags["keptn_result:"+string(keptnv2.ResultFailed)] || tags["keptn_result:"+string(keptnv2.ResultWarning)]
+	return failed && !tags[recoveredLabel]
+}
+
+func recoveryComment(cfg *Config, myKeptn *keptnv2.Keptn, data *keptnv2.EvaluationFinishedEventData) string {
+	comment := "Recovered: the quality gate for " + data.EventData.GetService() + " in " + data.EventData.GetProject() + "/" + data.EventData.GetStage() + " passed again ✅\n\n"
+	comment += "Score: " + fmt.Sprint(data.Evaluation.Score) + "\n"
+	comment += "Keptn Context ID: " + myKeptn.KeptnContext + "\n"
+	comment += "Link To Keptn's Bridge: " + cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	return comment
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+
+	"github.com/keptn-sandbox/zendesk-service/code/zendesk"
+)
+
+func TestIsRecoverable(t *testing.T) {
+	wanted := []string{"keptn_project:sockshop", "keptn_stage:production", "keptn_service:carts"}
+
+	tests := []struct {
+		name string
+		tags []string
+		want bool
+	}{
+		{name: "failed evaluation", tags: append([]string{"keptn_result:fail", "keptn_task:evaluation"}, wanted...), want: true},
+		{name: "warning evaluation", tags: append([]string{"keptn_result:warning"}, wanted...), want: true},
+		{name: "passed evaluation", tags: append([]string{"keptn_result:pass"}, wanted...), want: false},
+		{name: "already recovered", tags: append([]string{"keptn_result:fail", recoveredLabel}, wanted...), want: false},
+		{name: "other service", tags: []string{"keptn_result:fail", "keptn_project:sockshop", "keptn_stage:production", "keptn_service:orders"}, want: false},
+		{name: "failed deployment", tags: append([]string{"keptn_result:fail", "keptn_task:deployment"}, wanted...), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRecoverable(zendesk.Ticket{Tags: tt.tags}, wanted); got != tt.want {
+				t.Errorf("isRecoverable(%v) = %v, want %v", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRecoveredTickets(t *testing.T) {
+	search := fakeResponse{status: http.StatusOK, body: `{"results":[
+		{"id":1,"tags":["keptn_project:sockshop","keptn_stage:production","keptn_service:carts","keptn_result:fail"]},
+		{"id":2,"tags":["keptn_project:sockshop","keptn_stage:production","keptn_service:carts","keptn_result:fail","keptn_recovered"]}
+	]}`}
+	ok := fakeResponse{status: http.StatusOK, body: `{}`}
+
+	tests := []struct {
+		name       string
+		policy     string
+		responses  map[string]fakeResponse
+		wantErr    bool
+		wantCalls  []string
+		wantSolved bool
+	}{
+		{
+			name:       "solve",
+			policy:     recoveryPolicySolve,
+			responses:  map[string]fakeResponse{"GET /api/v2/search.json": search, "PUT /api/v2/tickets/1.json": ok},
+			wantCalls:  []string{"GET /api/v2/search.json", "PUT /api/v2/tickets/1.json"},
+			wantSolved: true,
+		},
+		{
+			name:      "comment",
+			policy:    recoveryPolicyComment,
+			responses: map[string]fakeResponse{"GET /api/v2/search.json": search, "PUT /api/v2/tickets/1.json": ok},
+			wantCalls: []string{"GET /api/v2/search.json", "PUT /api/v2/tickets/1.json"},
+		},
+		{
+			name:   "leave",
+			policy: recoveryPolicyLeave,
+		},
+		{
+			name:      "search forbidden for end users",
+			policy:    recoveryPolicySolve,
+			responses: map[string]fakeResponse{"GET /api/v2/search.json": {status: http.StatusForbidden}},
+			wantCalls: []string{"GET /api/v2/search.json"},
+		},
+		{
+			name:      "failed update does not stop the others",
+			policy:    recoveryPolicyComment,
+			responses: map[string]fakeResponse{"GET /api/v2/search.json": search, "PUT /api/v2/tickets/1.json": {status: http.StatusUnprocessableEntity}},
+			wantCalls: []string{"GET /api/v2/search.json", "PUT /api/v2/tickets/1.json"},
+		},
+		{
+			name:      "search failed",
+			policy:    recoveryPolicySolve,
+			responses: map[string]fakeResponse{"GET /api/v2/search.json": {status: http.StatusBadRequest}},
+			wantErr:   true,
+			wantCalls: []string{"GET /api/v2/search.json"},
+		},
+	}
+
+	myKeptn := &keptnv2.Keptn{KeptnBase: keptn.KeptnBase{KeptnContext: "ctx-1"}}
+	data := &keptnv2.EvaluationFinishedEventData{
+		EventData:  keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts", Result: keptnv2.ResultPass},
+		Evaluation: keptnv2.EvaluationDetails{Score: 100, Result: string(keptnv2.ResultPass)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zd := newFakeZendesk(t, tt.responses)
+			cfg := fakeZendeskConfig(zd)
+			cfg.Zendesk.RecoveryPolicy = tt.policy
+
+			if err := resolveRecoveredTickets(context.Background(), cfg, myKeptn, data); (err != nil) != tt.wantErr {
+				t.Fatalf("resolveRecoveredTickets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls := zd.called(); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+
+			update := zd.body("PUT /api/v2/tickets/1.json")
+			if len(tt.wantCalls) > 1 && !strings.Contains(update, recoveredLabel) {
+				t.Errorf("update = %s, want the %s tag", update, recoveredLabel)
+			}
+			if solved := strings.Contains(update, `"status":"solved"`); solved != tt.wantSolved {
+				t.Errorf("update = %s, want solved %v", update, tt.wantSolved)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Results of a configuration reload, see configReloads
+const (
+	reloadResultSuccess = "success"
+	reloadResultFailure = "failure"
+)
+
+// configSource hands out the live configuration. With CONFIG_DIR set it watches the files in the directory
+// and swaps in a new configuration when they change, e.g. when Kubernetes updates a mounted secret
+// An event loads the configuration once and keeps it until it is handled, so events in flight during a
+// reload finish with the configuration they started with
+type configSource struct {
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	reloadErr error
+}
+
+func newConfigSource(cfg *Config) *configSource {
+	s := &configSource{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Load returns the live configuration
+func (s *configSource) Load() *Config {
+	return s.current.Load()
+}
+
+// Returns why the last reload failed, nil if it succeeded. The live configuration is the last valid one in that case
+func (s *configSource) reloadError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reloadErr
+}
+
+// Checks CONFIG_DIR every CONFIG_RELOAD_INTERVAL and reloads the configuration when a file changed, until ctx is done.
+// Polling copes with the symlink swaps of secret volumes, which file notifications miss
+func (s *configSource) watch(ctx context.Context) {
+	cfg := s.Load()
+	interval := cfg.ConfigReloadInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("Watching configuration files", "dir", cfg.ConfigDir, "interval", interval.String())
+	fingerprint, _ := configDirFingerprint(cfg.ConfigDir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := configDirFingerprint(cfg.ConfigDir)
+		if err != nil {
+			slog.Warn("Could not check configuration files", "dir", cfg.ConfigDir, "error", err)
+			continue
+		}
+		if current == fingerprint {
+			continue
+		}
+		fingerprint = current
+		s.reload()
+	}
+}
+
+// Loads and validates the configuration and swaps it in. If that fails the error is logged and
+// the live configuration is kept, so a broken secret does not take down the service
+func (s *configSource) reload() (err error) {
+	defer func() {
+		s.mu.Lock()
+		s.reloadErr = err
+		s.mu.Unlock()
+
+		if err != nil {
+			configReloads.WithLabelValues(reloadResultFailure).Inc()
+			slog.Error("Could not reload the configuration, keeping the current one", "error", err)
+			return
+		}
+		configReloads.WithLabelValues(reloadResultSuccess).Inc()
+	}()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// New credentials must be masked before anything logs them
+	registerLogSecrets(cfg.secrets()...)
+
+	if err := swapZendeskClient(cfg.Zendesk); err != nil {
+		return err
+	}
+	live, restart := changedSettings(s.Load(), cfg)
+	s.current.Store(cfg)
+
+	slog.Info("Reloaded configuration", "changed", live)
+	if len(restart) > 0 {
+		slog.Warn("Some settings only take effect after a restart", "settings", restart)
+	}
+	return nil
+}
+
+// Hash of the settings in dir, see readConfigDir
+func configDirFingerprint(dir string) (string, error) {
+	files, err := readConfigDir(dir)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		hash.Write([]byte(name + "\x00" + files[name].value + "\x00"))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Writes the settings into dir, one file per setting
+func writeConfigDir(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConfigDirFingerprint(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(t *testing.T, dir string)
+		wantSame bool
+		wantErr  bool
+	}{
+		{name: "unchanged", change: func(t *testing.T, dir string) {}, wantSame: true},
+		{
+			name: "rewritten with the same value",
+			change: func(t *testing.T, dir string) {
+				writeConfigDir(t, dir, map[string]string{"ZENDESK_API_TOKEN": "api-token"})
+			},
+			wantSame: true,
+		},
+		{
+			name: "surrounding whitespace",
+			change: func(t *testing.T, dir string) {
+				writeConfigDir(t, dir, map[string]string{"ZENDESK_API_TOKEN": "api-token\n"})
+			},
+			wantSame: true,
+		},
+		{
+			name: "rotated secret",
+			change: func(t *testing.T, dir string) {
+				writeConfigDir(t, dir, map[string]string{"ZENDESK_API_TOKEN": "rotated-token"})
+			},
+		},
+		{
+			name:   "new setting",
+			change: func(t *testing.T, dir string) { writeConfigDir(t, dir, map[string]string{"zendesk-max-retries": "5"}) },
+		},
+		{
+			name:   "removed setting",
+			change: func(t *testing.T, dir string) { os.Remove(filepath.Join(dir, "ZENDESK_BASE_URL")) },
+		},
+		{
+			name:     "hidden file",
+			change:   func(t *testing.T, dir string) { writeConfigDir(t, dir, map[string]string{"..2026_10_18": "data"}) },
+			wantSame: true,
+		},
+		{
+			name:     "directory",
+			change:   func(t *testing.T, dir string) { os.Mkdir(filepath.Join(dir, "ZENDESK_MAX_RETRIES"), 0o700) },
+			wantSame: true,
+		},
+		{
+			name: "same setting in two files",
+			change: func(t *testing.T, dir string) {
+				writeConfigDir(t, dir, map[string]string{"zendesk-api-token": "api-token"})
+			},
+			wantErr: true,
+		},
+		{name: "directory is gone", change: func(t *testing.T, dir string) { os.RemoveAll(dir) }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigDir(t, dir, map[string]string{"ZENDESK_BASE_URL": "https://acme.zendesk.com", "ZENDESK_API_TOKEN": "api-token"})
+			before, err := configDirFingerprint(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(t, dir)
+			after, err := configDirFingerprint(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configDirFingerprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (after == before) != tt.wantSame {
+				t.Errorf("fingerprint changed = %v, want %v", after != before, !tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(cfg *Config)
+		wantLive    []string
+		wantRestart []string
+	}{
+		{name: "unchanged", modify: func(cfg *Config) {}},
+		{name: "rotated token", modify: func(cfg *Config) { cfg.Zendesk.APIToken = "rotated-token" }, wantLive: []string{"ZENDESK_API_TOKEN"}},
+		{name: "webhook secret", modify: func(cfg *Config) { cfg.WebhookSecret = "rotated-secret" }, wantLive: []string{"ZENDESK_WEBHOOK_SECRET"}},
+		{name: "port needs a restart", modify: func(cfg *Config) { cfg.Port = 9090 }, wantRestart: []string{"RCV_PORT"}},
+		{
+			name: "live and restart",
+			modify: func(cfg *Config) {
+				cfg.Port = 9090
+				cfg.Keptn.BridgeURL = "https://bridge.example.com"
+				cfg.Dynatrace.EventType = DtEventTypeAnnotation
+			},
+			wantLive:    []string{"KEPTN_BRIDGE_URL", "DT_EVENT_TYPE"},
+			wantRestart: []string{"RCV_PORT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := validConfig()
+			tt.modify(current)
+
+			live, restart := changedSettings(validConfig(), current)
+			if !reflect.DeepEqual(live, tt.wantLive) || !reflect.DeepEqual(restart, tt.wantRestart) {
+				t.Errorf("changedSettings() = %v, %v, want %v, %v", live, restart, tt.wantLive, tt.wantRestart)
+			}
+		})
+	}
+}
+
+func TestConfigSourceReload(t *testing.T) {
+	valid := map[string]string{
+		"ZENDESK_BASE_URL":       "https://acme.zendesk.com",
+		"ZENDESK_END_USER_EMAIL": "jane@example.com",
+		"ZENDESK_API_TOKEN":      "rotated-token",
+		"KEPTN_DOMAIN":           "https://keptn.example.com",
+	}
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		wantErr   bool
+		wantToken string
+	}{
+		{name: "rotated token", files: valid, wantToken: "rotated-token"},
+		{name: "unparsable value", files: map[string]string{"ZENDESK_MAX_RETRIES": "three"}, wantErr: true, wantToken: "api-token"},
+		{name: "invalid configuration", files: map[string]string{"ZENDESK_BASE_URL": "acme.zendesk.com"}, wantErr: true, wantToken: "api-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigDir(t, dir, valid)
+			// Broken files keep the live configuration, including its token
+			writeConfigDir(t, dir, tt.files)
+			t.Setenv("CONFIG_DIR", dir)
+
+			source := newConfigSource(validConfig())
+			err := source.reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if reloadErr := source.reloadError(); reloadErr != err {
+				t.Errorf("reloadError() = %v, want %v", reloadErr, err)
+			}
+			if token := source.Load().Zendesk.APIToken; token != tt.wantToken {
+				t.Errorf("live ZENDESK_API_TOKEN = %q, want %q", token, tt.wantToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// Tasks whose tickets are shaped by the rules of zendesk.yaml
+var ruleTasks = map[string]bool{keptnv2.EvaluationTaskName: true, keptnv2.RemediationTaskName: true}
+
+// TicketRule sets priority, type, tags and group of the tickets of matching events, e.g.
+//
+//	rules:
+//	  - name: production failures
+//	    match:
+//	      stages: ["production", "prod-*"]
+//	      results: ["fail"]
+//	    set:
+//	      priority: urgent
+//	      type: incident
+//	      tags: ["sev1"]
+//	  - name: dev warnings
+//	    match:
+//	      stages: ["dev"]
+//	      results: ["warning"]
+//	    set:
+//	      priority: low
+//	      type: task
+//
+// Rules are checked in order and the first matching rule wins. Its settings override defaults and events
+type TicketRule struct {
+	Name  string    `yaml:"name"`
+	Match RuleMatch `yaml:"match"`
+	Set   RuleSet   `yaml:"set"`
+}
+
+// RuleMatch lists the conditions of a rule. All conditions that are set must hold, a list matches if one of its entries does
+// Projects, stages and services may be patterns like "prod-*", see path.Match
+type RuleMatch struct {
+	// Events are Keptn tasks: evaluation or remediation
+	Events   []string `yaml:"events,omitempty"`
+	Projects []string `yaml:"projects,omitempty"`
+	Stages   []string `yaml:"stages,omitempty"`
+	Services []string `yaml:"services,omitempty"`
+	Results  []string `yaml:"results,omitempty"`
+	// Score of the evaluation. Events without a score, e.g. remediations, never match a score range
+	Score *ScoreRange `yaml:"score,omitempty"`
+	// Labels of the event, all must be present with the given value
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// ScoreRange is an inclusive range of evaluation scores, either bound may be left out
+type ScoreRange struct {
+	Min *float64 `yaml:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty"`
+}
+
+// RuleSet is what a matching rule does to the ticket
+type RuleSet struct {
+	Priority string `yaml:"priority,omitempty"`
+	// Type is one of problem, incident, question or task
+	Type string `yaml:"type,omitempty"`
+	// Tags are added to the tags of zendesk.yaml
+	Tags    []string `yaml:"tags,omitempty"`
+	GroupID int64    `yaml:"groupId,omitempty"`
+}
+
+// ruleEvent is what the rules are matched against
+type ruleEvent struct {
+	task    string
+	project string
+	stage   string
+	service string
+	result  string
+	// nil if the event has no score
+	score  *float64
+	labels map[string]string
+}
+
+func evaluationRuleEvent(data *keptnv2.EvaluationFinishedEventData) ruleEvent {
+	score := data.Evaluation.Score
+	return ruleEvent{
+		task:    keptnv2.EvaluationTaskName,
+		project: data.EventData.GetProject(),
+		stage:   data.EventData.GetStage(),
+		service: data.EventData.GetService(),
+		result:  data.Evaluation.Result,
+		score:   &score,
+		labels:  data.Labels,
+	}
+}
+
+func remediationRuleEvent(data *keptnv2.RemediationFinishedEventData) ruleEvent {
+	return ruleEvent{
+		task:    keptnv2.RemediationTaskName,
+		project: data.EventData.GetProject(),
+		stage:   data.EventData.GetStage(),
+		service: data.EventData.GetService(),
+		result:  string(data.Result),
+		labels:  data.Labels,
+	}
+}
+
+// Returns the first rule matching the event, nil if there is none or no zendesk.yaml
+func (c *ZendeskConfig) matchRule(event ruleEvent) *TicketRule {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Rules {
+		if c.Rules[i].matches(event) {
+			return &c.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (r TicketRule) matches(event ruleEvent) bool {
+	m := r.Match
+	if !matchesAny(m.Events, event.task, false) ||
+		!matchesAny(m.Projects, event.project, true) ||
+		!matchesAny(m.Stages, event.stage, true) ||
+		!matchesAny(m.Services, event.service, true) ||
+		!matchesAny(m.Results, event.result, false) {
+		return false
+	}
+	if m.Score != nil {
+		if event.score == nil {
+			return false
+		}
+		if (m.Score.Min != nil && *event.score < *m.Score.Min) || (m.Score.Max != nil && *event.score > *m.Score.Max) {
+			return false
+		}
+	}
+	for key, value := range m.Labels {
+		if actual, ok := event.labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// An empty list matches everything
+func matchesAny(patterns []string, value string, glob bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == value {
+			return true
+		}
+		if glob {
+			if matched, _ := path.Match(pattern, value); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the settings with the fields of the rule applied
+func (r TicketRule) apply(settings TicketSettings) TicketSettings {
+	if r.Set.Priority != "" {
+		settings.Priority = r.Set.Priority
+	}
+	if r.Set.Type != "" {
+		settings.Type = r.Set.Type
+	}
+	if r.Set.GroupID != 0 {
+		settings.GroupID = r.Set.GroupID
+	}
+	settings.Tags = append(append([]string{}, settings.Tags...), r.Set.Tags...)
+	return settings
+}
+
+func (r TicketRule) validate() error {
+	for _, task := range r.Match.Events {
+		if !ruleTasks[task] {
+			return fmt.Errorf("invalid event %q, expected %s or %s", task, keptnv2.EvaluationTaskName, keptnv2.RemediationTaskName)
+		}
+	}
+	for _, patterns := range [][]string{r.Match.Projects, r.Match.Stages, r.Match.Services} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q", pattern)
+			}
+		}
+	}
+	for _, result := range r.Match.Results {
+		switch keptnv2.ResultType(result) {
+		case keptnv2.ResultPass, keptnv2.ResultWarning, keptnv2.ResultFailed:
+		default:
+			return fmt.Errorf("invalid result %q", result)
+		}
+	}
+	if score := r.Match.Score; score != nil && score.Min != nil && score.Max != nil && *score.Min > *score.Max {
+		return fmt.Errorf("score min %v is greater than max %v", *score.Min, *score.Max)
+	}
+	if !validPriorities[r.Set.Priority] {
+		return fmt.Errorf("invalid priority %q", r.Set.Priority)
+	}
+	if !validTicketTypes[r.Set.Type] {
+		return fmt.Errorf("invalid type %q", r.Set.Type)
+	}
+	return nil
+}
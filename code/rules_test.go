@@ -0,0 +1,156 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func TestTicketRuleMatches(t *testing.T) {
+	failedEvaluation := ruleEvent{
+		task:    keptnv2.EvaluationTaskName,
+		project: "sockshop",
+		stage:   "prod-eu",
+		service: "carts",
+		result:  "fail",
+		score:   float(40),
+		labels:  map[string]string{"team": "payments"},
+	}
+	remediation := ruleEvent{
+		task:    keptnv2.RemediationTaskName,
+		project: "sockshop",
+		stage:   "production",
+		service: "carts",
+		result:  "pass",
+	}
+
+	tests := []struct {
+		name  string
+		match RuleMatch
+		event ruleEvent
+		want  bool
+	}{
+		{name: "empty match", match: RuleMatch{}, event: failedEvaluation, want: true},
+		{name: "event", match: RuleMatch{Events: []string{"evaluation"}}, event: failedEvaluation, want: true},
+		{name: "other event", match: RuleMatch{Events: []string{"evaluation"}}, event: remediation, want: false},
+		{name: "one of the results", match: RuleMatch{Results: []string{"warning", "fail"}}, event: failedEvaluation, want: true},
+		{name: "result is not a pattern", match: RuleMatch{Results: []string{"f*"}}, event: failedEvaluation, want: false},
+		{name: "stage pattern", match: RuleMatch{Stages: []string{"production", "prod-*"}}, event: failedEvaluation, want: true},
+		{name: "stage pattern mismatch", match: RuleMatch{Stages: []string{"dev-*"}}, event: failedEvaluation, want: false},
+		{name: "project and service", match: RuleMatch{Projects: []string{"sockshop"}, Services: []string{"cart?"}}, event: failedEvaluation, want: true},
+		{name: "all conditions must hold", match: RuleMatch{Projects: []string{"sockshop"}, Results: []string{"pass"}}, event: failedEvaluation, want: false},
+		{name: "score in range", match: RuleMatch{Score: &ScoreRange{Min: float(0), Max: float(50)}}, event: failedEvaluation, want: true},
+		{name: "score range is inclusive", match: RuleMatch{Score: &ScoreRange{Max: float(40)}}, event: failedEvaluation, want: true},
+		{name: "score below min", match: RuleMatch{Score: &ScoreRange{Min: float(50)}}, event: failedEvaluation, want: false},
+		{name: "score above max", match: RuleMatch{Score: &ScoreRange{Max: float(39.9)}}, event: failedEvaluation, want: false},
+		{name: "no score never matches a score range", match: RuleMatch{Score: &ScoreRange{}}, event: remediation, want: false},
+		{name: "label", match: RuleMatch{Labels: map[string]string{"team": "payments"}}, event: failedEvaluation, want: true},
+		{name: "label with other value", match: RuleMatch{Labels: map[string]string{"team": "shipping"}}, event: failedEvaluation, want: false},
+		{name: "missing label", match: RuleMatch{Labels: map[string]string{"team": "payments"}}, event: remediation, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := TicketRule{Name: tt.name, Match: tt.match}
+			if got := rule.matches(tt.event); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	config := &ZendeskConfig{Rules: []TicketRule{
+		{Name: "production failures", Match: RuleMatch{Stages: []string{"production", "prod-*"}, Results: []string{"fail"}}},
+		{Name: "failures", Match: RuleMatch{Results: []string{"fail"}}},
+		{Name: "dev warnings", Match: RuleMatch{Stages: []string{"dev"}, Results: []string{"warning"}}},
+	}}
+
+	tests := []struct {
+		name   string
+		config *ZendeskConfig
+		event  ruleEvent
+		want   string
+	}{
+		{name: "first match wins", config: config, event: ruleEvent{stage: "prod-eu", result: "fail"}, want: "production failures"},
+		{name: "later rule", config: config, event: ruleEvent{stage: "staging", result: "fail"}, want: "failures"},
+		{name: "dev warning", config: config, event: ruleEvent{stage: "dev", result: "warning"}, want: "dev warnings"},
+		{name: "no match", config: config, event: ruleEvent{stage: "dev", result: "pass"}},
+		{name: "no zendesk.yaml", event: ruleEvent{stage: "dev", result: "fail"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.config.matchRule(tt.event)
+			got := ""
+			if rule != nil {
+				got = rule.Name
+			}
+			if got != tt.want {
+				t.Errorf("matchRule() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTicketRuleApply(t *testing.T) {
+	defaults := TicketSettings{Priority: "normal", Type: "problem", GroupID: 1, Tags: []string{"keptn"}}
+
+	tests := []struct {
+		name string
+		set  RuleSet
+		want TicketSettings
+	}{
+		{name: "nothing set", set: RuleSet{}, want: TicketSettings{Priority: "normal", Type: "problem", GroupID: 1, Tags: []string{"keptn"}}},
+		{
+			name: "everything set",
+			set:  RuleSet{Priority: "urgent", Type: "incident", GroupID: 2, Tags: []string{"sev1"}},
+			want: TicketSettings{Priority: "urgent", Type: "incident", GroupID: 2, Tags: []string{"keptn", "sev1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TicketRule{Set: tt.set}.apply(defaults)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if len(defaults.Tags) != 1 {
+		t.Errorf("apply() changed the tags of the defaults: %v", defaults.Tags)
+	}
+}
+
+func TestTicketRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    TicketRule
+		wantErr bool
+	}{
+		{name: "valid", rule: TicketRule{
+			Match: RuleMatch{Events: []string{"evaluation"}, Stages: []string{"prod-*"}, Results: []string{"fail"}, Score: &ScoreRange{Min: float(0), Max: float(50)}},
+			Set:   RuleSet{Priority: "urgent", Type: "incident"},
+		}},
+		{name: "empty", rule: TicketRule{}},
+		{name: "unknown event", rule: TicketRule{Match: RuleMatch{Events: []string{"deployment"}}}, wantErr: true},
+		{name: "invalid pattern", rule: TicketRule{Match: RuleMatch{Services: []string{"[carts"}}}, wantErr: true},
+		{name: "unknown result", rule: TicketRule{Match: RuleMatch{Results: []string{"failed"}}}, wantErr: true},
+		{name: "min above max", rule: TicketRule{Match: RuleMatch{Score: &ScoreRange{Min: float(80), Max: float(50)}}}, wantErr: true},
+		{name: "unknown priority", rule: TicketRule{Set: RuleSet{Priority: "critical"}}, wantErr: true},
+		{name: "unknown type", rule: TicketRule{Set: RuleSet{Type: "bug"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileSink appends every notification as one JSON line to SINK_FILE_PATH, e.g. for auditing
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newFileSink(config *configSource) (Sink, error) {
+	path := os.Getenv(sinkEnvVar("file", "PATH"))
+	if path == "" {
+		return nil, fmt.Errorf("%s must be set", sinkEnvVar("file", "PATH"))
+	}
+	return &fileSink{path: path}, nil
+}
+
+func (s *fileSink) Name() string {
+	return "file"
+}
+
+func (s *fileSink) Send(ctx context.Context, notification Notification) error {
+	line, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("could not encode notification: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", s.path, err)
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write to %s: %w", s.path, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// webhookSink POSTs every notification as JSON to SINK_WEBHOOK_URL
+// SINK_WEBHOOK_AUTHORIZATION is sent as Authorization header if set
+type webhookSink struct {
+	url           string
+	authorization string
+	client        *http.Client
+}
+
+func newWebhookSink(config *configSource) (Sink, error) {
+	webhookURL := os.Getenv(sinkEnvVar("webhook", "URL"))
+	if webhookURL == "" {
+		return nil, fmt.Errorf("%s must be set", sinkEnvVar("webhook", "URL"))
+	}
+	if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%s must be an http(s) URL", sinkEnvVar("webhook", "URL"))
+	}
+
+	authorization := os.Getenv(sinkEnvVar("webhook", "AUTHORIZATION"))
+	registerLogSecrets(authorization)
+
+	return &webhookSink{
+		url:           webhookURL,
+		authorization: authorization,
+		client:        instrumentedHTTPClient(downstreamWebhook, 30*time.Second),
+	}, nil
+}
+
+func (s *webhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *webhookSink) Send(ctx context.Context, notification Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("could not encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", ServiceName)
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Notification is what the sinks receive once a ticket has been created or updated for a Keptn event
+type Notification struct {
+	// Kind is the Keptn task the ticket is about (evaluation, remediation, ...)
+	Kind         string            `json:"kind"`
+	TicketID     int64             `json:"ticketId"`
+	TicketURL    string            `json:"ticketUrl"`
+	KeptnContext string            `json:"keptnContext"`
+	EventID      string            `json:"eventId"`
+	Project      string            `json:"project"`
+	Stage        string            `json:"stage"`
+	Service      string            `json:"service"`
+	Result       string            `json:"result,omitempty"`
+	Properties   map[string]string `json:"properties,omitempty"`
+	Time         time.Time         `json:"time"`
+}
+
+// Sink forwards notifications to a destination (Dynatrace, a webhook, a file, ...)
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, notification Notification) error
+}
+
+// sinkChecker is implemented by sinks that can verify their credentials. Failing checks make the service not ready
+type sinkChecker interface {
+	Check(ctx context.Context) error
+}
+
+// sinkFactory creates a sink from the live configuration and its SINK_<NAME>_* env vars
+// It returns an error if mandatory settings are missing
+type sinkFactory func(config *configSource) (Sink, error)
+
+// Registry of the sinks that can be enabled through the SINKS env var
+var sinkFactories = map[string]sinkFactory{
+	"dynatrace": newDynatraceSink,
+	"webhook":   newWebhookSink,
+	"file":      newFileSink,
+}
+
+// registeredSinks returns the names of all available sinks
+func registeredSinks() []string {
+	names := []string{}
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// activeSink is an enabled sink with its own retry settings and error accounting
+type activeSink struct {
+	sink    Sink
+	retries int
+
+	sent   uint64
+	failed uint64
+}
+
+// The sinks enabled at startup, see setupSinks
+var notificationSinks []*activeSink
+
+const defaultSinkRetries = 2
+
+// Creates the sinks listed in SINKS (comma separated, e.g. "dynatrace,webhook,file")
+// For backwards compatibility SEND_EVENT=true without SINKS enables the dynatrace sink
+// Each sink reads SINK_<NAME>_RETRIES (default 2). Misconfigured sinks are skipped and reported
+func setupSinks(config *configSource) []*activeSink {
+	cfg := config.Load()
+	sinkNames := cfg.Sinks
+	if sinkNames == "" && cfg.SendEvent {
+		sinkNames = "dynatrace"
+	}
+
+	sinks := []*activeSink{}
+	for _, name := range strings.Split(sinkNames, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		factory, ok := sinkFactories[name]
+		if !ok {
+			slog.Warn("Unknown sink in SINKS", "sink", name, "available", strings.Join(registeredSinks(), ", "))
+			continue
+		}
+		sink, err := factory(config)
+		if err != nil {
+			slog.Warn("Sink is not enabled", "sink", name, "error", err)
+			continue
+		}
+
+		retries, err := strconv.Atoi(os.Getenv(sinkEnvVar(name, "RETRIES")))
+		if err != nil || retries < 0 {
+			retries = defaultSinkRetries
+		}
+
+		slog.Info("Enabled sink", "sink", name, "retries", retries)
+		sinks = append(sinks, &activeSink{sink: sink, retries: retries})
+	}
+	return sinks
+}
+
+// Returns the name of a sink specific env var, e.g. SINK_WEBHOOK_URL
+func sinkEnvVar(sinkName string, setting string) string {
+	return "SINK_" + strings.ToUpper(sinkName) + "_" + setting
+}
+
+// Sends a notification to all enabled sinks in parallel
+// A failing sink is retried on its own and does not affect the other sinks
+func notifySinks(ctx context.Context, notification Notification) {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now().UTC()
+	}
+
+	var wg sync.WaitGroup
+	for _, sink := range notificationSinks {
+		wg.Add(1)
+		go func(sink *activeSink) {
+			defer wg.Done()
+			sink.send(ctx, notification)
+		}(sink)
+	}
+	wg.Wait()
+}
+
+func (s *activeSink) send(ctx context.Context, notification Notification) {
+	name := s.sink.Name()
+	wait := time.Second
+
+	ctx, span := tracer.Start(ctx, "sink "+name, trace.WithAttributes(
+		sinkNameKey.String(name),
+		keptnContextKey.String(notification.KeptnContext),
+		zendeskTicketIDKey.Int64(notification.TicketID)))
+	var err error
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 0; ; attempt++ {
+		err = s.sink.Send(ctx, notification)
+		if err == nil {
+			atomic.AddUint64(&s.sent, 1)
+			return
+		}
+
+		if attempt >= s.retries || ctx.Err() != nil {
+			failed := atomic.AddUint64(&s.failed, 1)
+			slog.ErrorContext(ctx, "Sink failed", "sink", name, "ticketURL", notification.TicketURL, "attempts", attempt+1, "error", err,
+				"failures", failed, "successes", atomic.LoadUint64(&s.sent))
+			return
+		}
+
+		slog.WarnContext(ctx, "Sink failed, retrying", "sink", name, "ticketURL", notification.TicketURL, "attempt", attempt+1, "wait", wait.String(), "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// Describes the enabled sinks for the debug output
+func describeSinks(sinks []*activeSink) string {
+	if len(sinks) == 0 {
+		return "none"
+	}
+	names := []string{}
+	for _, sink := range sinks {
+		names = append(names, fmt.Sprintf("%s (%d retries)", sink.sink.Name(), sink.retries))
+	}
+	return strings.Join(names, ", ")
+}
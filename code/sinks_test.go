@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// failingSink fails the first failures calls of Send
+type failingSink struct {
+	failures int32
+	calls    int32
+}
+
+func (s *failingSink) Name() string {
+	return "failing"
+}
+
+func (s *failingSink) Send(ctx context.Context, notification Notification) error {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return errors.New("sink is down")
+	}
+	return nil
+}
+
+func TestSetupSinks(t *testing.T) {
+	tests := []struct {
+		name      string
+		sinks     string
+		sendEvent bool
+		env       map[string]string
+		want      []string
+	}{
+		{name: "none"},
+		{name: "file", sinks: "file", env: map[string]string{"SINK_FILE_PATH": "/tmp/tickets.jsonl"}, want: []string{"file (2 retries)"}},
+		{
+			name:  "several with retries",
+			sinks: " file , webhook",
+			env:   map[string]string{"SINK_FILE_PATH": "/tmp/tickets.jsonl", "SINK_WEBHOOK_URL": "https://hooks.example.com", "SINK_WEBHOOK_RETRIES": "5"},
+			want:  []string{"file (2 retries)", "webhook (5 retries)"},
+		},
+		{name: "invalid retries", sinks: "file", env: map[string]string{"SINK_FILE_PATH": "/tmp/tickets.jsonl", "SINK_FILE_RETRIES": "-1"}, want: []string{"file (2 retries)"}},
+		{name: "SEND_EVENT enables dynatrace", sendEvent: true, want: []string{"dynatrace (2 retries)"}},
+		{name: "SINKS wins over SEND_EVENT", sinks: "file", sendEvent: true, env: map[string]string{"SINK_FILE_PATH": "/tmp/tickets.jsonl"}, want: []string{"file (2 retries)"}},
+		{name: "unknown sink is skipped", sinks: "slack,file", env: map[string]string{"SINK_FILE_PATH": "/tmp/tickets.jsonl"}, want: []string{"file (2 retries)"}},
+		{name: "misconfigured sink is skipped", sinks: "webhook,file", env: map[string]string{"SINK_FILE_PATH": "/tmp/tickets.jsonl", "SINK_WEBHOOK_URL": "hooks.example.com"}, want: []string{"file (2 retries)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg := validConfig()
+			cfg.Sinks = tt.sinks
+			cfg.SendEvent = tt.sendEvent
+			cfg.Dynatrace.Tenant = "abc12345.live.dynatrace.com"
+			cfg.Dynatrace.APIToken = "dt0c01.token"
+
+			var got []string
+			for _, sink := range setupSinks(newConfigSource(cfg)) {
+				got = append(got, describeSinks([]*activeSink{sink}))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sinks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveSinkSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		retries   int
+		wantCalls int32
+		wantSent  uint64
+	}{
+		{name: "sent", failures: 0, retries: 2, wantCalls: 1, wantSent: 1},
+		{name: "sent after a retry", failures: 1, retries: 2, wantCalls: 2, wantSent: 1},
+		{name: "failed without retries", failures: 1, retries: 0, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &failingSink{failures: tt.failures}
+			active := &activeSink{sink: sink, retries: tt.retries}
+			active.send(context.Background(), Notification{TicketID: 42})
+
+			if sink.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", sink.calls, tt.wantCalls)
+			}
+			if active.sent != tt.wantSent || active.failed != 1-tt.wantSent {
+				t.Errorf("sent = %d, failed = %d, want sent %d", active.sent, active.failed, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		authorization string
+		wantErr       bool
+	}{
+		{name: "accepted", status: http.StatusNoContent},
+		{name: "with authorization", status: http.StatusOK, authorization: "Bearer webhook-token"},
+		{name: "rejected", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan *http.Request, 1)
+			notifications := make(chan Notification, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				notification := Notification{}
+				json.NewDecoder(r.Body).Decode(&notification)
+				received <- r
+				notifications <- notification
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			t.Setenv("SINK_WEBHOOK_URL", server.URL)
+			t.Setenv("SINK_WEBHOOK_AUTHORIZATION", tt.authorization)
+			sink, err := newWebhookSink(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := sink.Send(context.Background(), Notification{Kind: "evaluation", TicketID: 42}); (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			r := <-received
+			if r.Method != http.MethodPost || r.Header.Get("Authorization") != tt.authorization {
+				t.Errorf("request = %s with Authorization %q, want POST with %q", r.Method, r.Header.Get("Authorization"), tt.authorization)
+			}
+			if notification := <-notifications; notification.Kind != "evaluation" || notification.TicketID != 42 {
+				t.Errorf("notification = %+v", notification)
+			}
+		})
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.jsonl")
+	t.Setenv("SINK_FILE_PATH", path)
+	sink, err := newFileSink(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ticketID := range []int64{1, 2} {
+		if err := sink.Send(context.Background(), Notification{TicketID: ticketID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("file has %d lines, want 2:\n%s", len(lines), content)
+	}
+	for i, line := range lines {
+		notification := Notification{}
+		if err := json.Unmarshal([]byte(line), &notification); err != nil || notification.TicketID != int64(i+1) {
+			t.Errorf("line %d = %s, %v", i+1, line, err)
+		}
+	}
+}
@@ -1,61 +1,45 @@
 package main
 
-type DtInfoEvent struct {
-	EventType string `json:"eventType"`
-	Source    string `json:"source"`
-	//Start            int               `json: "start,omitempty"`
-	//End              int               `json: "end,omitempty"`
-	AttachRules      DtAttachRules     `json:"attachRules"`
-	CustomProperties map[string]string `json:"customProperties"`
-	Description      string            `json:"description"`
-	Title            string            `json:"title"`
-}
-
-type DtAttachRules struct {
-	TagRule []DtTagRule `json:"tagRule"`
-}
-
-// DtTag defines a Dynatrace configuration structure
-type DtTag struct {
-	Context string `json:"context"`
-	Key     string `json:"key"`
-	Value   string `json:"value,omitempty"`
-}
-
-// DtTagRule defines a Dynatrace configuration structure
-type DtTagRule struct {
-	MeTypes []string `json:"meTypes"`
-	Tags    []DtTag  `json:"tags"`
-}
+// Dynatrace event types supported by the Events API v2 ingest endpoint
+const (
+	DtEventTypeInfo          = "CUSTOM_INFO"
+	DtEventTypeAnnotation    = "CUSTOM_ANNOTATION"
+	DtEventTypeConfiguration = "CUSTOM_CONFIGURATION"
+)
 
-// Zendesk structs
-type ZDTicket struct {
-	Request ZDRequest `json:"request"`
+// DtEvent is the payload of POST /api/v2/events/ingest
+type DtEvent struct {
+	EventType      string            `json:"eventType"`
+	Title          string            `json:"title"`
+	EntitySelector string            `json:"entitySelector,omitempty"`
+	StartTime      int64             `json:"startTime,omitempty"`
+	EndTime        int64             `json:"endTime,omitempty"`
+	Properties     map[string]string `json:"properties,omitempty"`
 }
 
-type ZDRequest struct {
-	Requester ZDRequester `json:"requester"`
-	Subject   string      `json:"subject"`
-	Comment   ZDComment   `json:"comment"`
-	Tags      []string    `json:"tags"`
+// DtEventIngestResponse tells how many entities an event was attached to
+type DtEventIngestResponse struct {
+	ReportCount        int                   `json:"reportCount"`
+	EventIngestResults []DtEventIngestResult `json:"eventIngestResults"`
 }
 
-type ZDRequester struct {
-	Name string `json:"name"`
+// DtEventIngestResult is the outcome for a single entity
+type DtEventIngestResult struct {
+	CorrelationID string `json:"correlationId"`
+	Status        string `json:"status"`
 }
 
-type ZDComment struct {
-	HTMLBody string `json:"html_body"`
-}
+// Scope the API token needs to send events
+const DtScopeEventsIngest = "events.ingest"
 
-// Model the API response object
-type ZDTicketResponse struct {
-	Request ZDResponseRequest `json:"request"`
+// DtAPITokenLookup is the payload of POST /api/v2/apiTokens/lookup
+type DtAPITokenLookup struct {
+	Token string `json:"token"`
 }
 
-type ZDResponseRequest struct {
-	Description string `json:"description"`
-	ID          int    `json:"id"`
-	Status      string `json:"status"`
-	Subject     string `json:"subject"`
+// DtAPIToken is the metadata Dynatrace returns for an API token
+type DtAPIToken struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Scopes  []string `json:"scopes"`
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Built-in ticket templates. For every Keptn task there is a
+// <task>_subject.tmpl (text/template) and a <task>_body.html.tmpl (html/template)
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// TemplateSettings override the built-in templates, see zendesk.yaml
+type TemplateSettings struct {
+	// Subject is an inline text/template for the ticket subject
+	Subject string `yaml:"subject,omitempty"`
+	// Body is an inline html/template for the ticket body
+	Body string `yaml:"body,omitempty"`
+	// BodyResource is the URI of an html/template in the Keptn configuration repo, e.g. zendesk/evaluation.html
+	// It is resolved like zendesk.yaml (service, stage, then project level) and wins over Body
+	BodyResource string `yaml:"bodyResource,omitempty"`
+}
+
+// ticketTemplateData is what the subject and body templates are executed with
+type ticketTemplateData struct {
+	KeptnContext string
+	Project      string
+	Stage        string
+	Service      string
+	Result       string
+	Labels       map[string]string
+	// Data is the event data of the incoming event, e.g. *keptnv2.EvaluationFinishedEventData
+	Data interface{}
+
+	// keptn backs the bridgeLink function
+	keptn KeptnDetails
+}
+
+func newTicketTemplateData(cfg *Config, myKeptn *keptnv2.Keptn, data keptnv2.EventData, result string, eventData interface{}) ticketTemplateData {
+	return ticketTemplateData{
+		KeptnContext: myKeptn.KeptnContext,
+		Project:      data.GetProject(),
+		Stage:        data.GetStage(),
+		Service:      data.GetService(),
+		Result:       result,
+		Labels:       data.GetLabels(),
+		Data:         eventData,
+		keptn:        cfg.Keptn,
+	}
+}
+
+// Helper functions available in all templates, plus bridgeLink, see dataFuncs
+var templateFuncs = map[string]interface{}{
+	"resultEmoji":    resultEmoji,
+	"indicatorName":  indicatorName,
+	"indicatorTable": indicatorTable,
+	"formatValue":    formatValue,
+}
+
+// The indicator table is a template of its own. It cannot use templateFuncs as that would be an initialization cycle
+var indicatorTableTemplate = htmltemplate.Must(htmltemplate.New("indicators.html.tmpl").Funcs(htmltemplate.FuncMap{
+	"resultEmoji":   resultEmoji,
+	"indicatorName": indicatorName,
+	"formatValue":   formatValue,
+}).ParseFS(defaultTemplates, "templates/indicators.html.tmpl"))
+
+// Returns the emoji for a Keptn result (pass, warning, fail)
+func resultEmoji(result string) string {
+	switch keptnv2.ResultType(result) {
+	case keptnv2.ResultPass:
+		return "✅"
+	case keptnv2.ResultWarning:
+		return "⚠"
+	case keptnv2.ResultFailed:
+		return "❌"
+	}
+	return ""
+}
+
+// Helper functions that depend on the configuration: bridgeLink <project> <keptnContext>
+func (data ticketTemplateData) dataFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"bridgeLink": data.keptn.BridgeLink,
+	}
+}
+
+// Returns the display name of an SLI, falling back to the metric name
+func indicatorName(indicator *keptnv2.SLIEvaluationResult) string {
+	if indicator.DisplayName != "" {
+		return indicator.DisplayName
+	}
+	if indicator.Value != nil {
+		return indicator.Value.Metric
+	}
+	return ""
+}
+
+// Formats SLI values and scores without trailing zeros, e.g. 12 or 0.345
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Renders the SLI results of an evaluation as an HTML table with one row per indicator:
+// value, pass and warning criteria (met or violated), score, status and key SLI flag
+// Rows of failed indicators are highlighted
+func indicatorTable(indicators []*keptnv2.SLIEvaluationResult) (htmltemplate.HTML, error) {
+	var out bytes.Buffer
+	if err := indicatorTableTemplate.Execute(&out, indicators); err != nil {
+		return "", err
+	}
+	return htmltemplate.HTML(out.String()), nil
+}
+
+// Renders the subject and the HTML body of a ticket for a Keptn task (evaluation, remediation, ...)
+// Overrides from zendesk.yaml are used if they parse and execute, otherwise the built-in templates apply
+func renderTicket(ctx context.Context, myKeptn *keptnv2.Keptn, taskName string, templates TemplateSettings, data ticketTemplateData) (subject string, body string, err error) {
+	_, span := tracer.Start(ctx, "renderTicket", trace.WithAttributes(keptnTaskKey.String(taskName)))
+	defer func() { endSpan(span, err) }()
+
+	subject, err = renderSubject(ctx, taskName, templates.Subject, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	bodyTemplate := templates.Body
+	if templates.BodyResource != "" {
+		content, location, err := fetchKeptnResource(myKeptn, templates.BodyResource)
+		if err != nil || content == nil {
+			slog.WarnContext(ctx, "Could not fetch template. Using the built-in template", "resource", templates.BodyResource, "task", taskName, "error", err)
+		} else {
+			slog.DebugContext(ctx, "Using template", "resource", templates.BodyResource, "location", location)
+			bodyTemplate = string(content)
+		}
+	}
+
+	body, err = renderBody(ctx, taskName, bodyTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return subject, body, nil
+}
+
+func renderSubject(ctx context.Context, taskName string, override string, data ticketTemplateData) (string, error) {
+	if override != "" {
+		subject, err := executeTextTemplate(taskName+"_subject", override, data)
+		if err == nil {
+			return subject, nil
+		}
+		slog.WarnContext(ctx, "Subject template from zendesk.yaml failed. Using the built-in template", "task", taskName, "error", err)
+	}
+
+	builtin, err := defaultTemplates.ReadFile("templates/" + taskName + "_subject.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("no built-in subject template for %s: %w", taskName, err)
+	}
+	return executeTextTemplate(taskName+"_subject", string(builtin), data)
+}
+
+func renderBody(ctx context.Context, taskName string, override string, data ticketTemplateData) (string, error) {
+	if override != "" {
+		body, err := executeHTMLTemplate(taskName+"_body", override, data)
+		if err == nil {
+			return body, nil
+		}
+		slog.WarnContext(ctx, "Body template override failed. Using the built-in template", "task", taskName, "error", err)
+	}
+
+	builtin, err := defaultTemplates.ReadFile("templates/" + taskName + "_body.html.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("no built-in body template for %s: %w", taskName, err)
+	}
+	return executeHTMLTemplate(taskName+"_body", string(builtin), data)
+}
+
+func executeTextTemplate(name string, text string, data ticketTemplateData) (string, error) {
+	tmpl, err := texttemplate.New(name).Funcs(templateFuncs).Funcs(data.dataFuncs()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template %s: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("could not execute template %s: %w", name, err)
+	}
+	// Subjects are single line
+	return strings.TrimSpace(out.String()), nil
+}
+
+func executeHTMLTemplate(name string, text string, data ticketTemplateData) (string, error) {
+	tmpl, err := htmltemplate.New(name).Funcs(templateFuncs).Funcs(data.dataFuncs()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template %s: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("could not execute template %s: %w", name, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func TestRenderTicket(t *testing.T) {
+	evaluation := &keptnv2.EvaluationFinishedEventData{
+		Evaluation: keptnv2.EvaluationDetails{
+			Score: 42.5,
+			IndicatorResults: []*keptnv2.SLIEvaluationResult{
+				{Score: 0, Status: "fail", DisplayName: "Response time", Value: &keptnv2.SLIResult{Metric: "response_time_p95", Value: 1200}},
+			},
+		},
+	}
+	data := ticketTemplateData{
+		KeptnContext: "ctx-1",
+		Project:      "sockshop",
+		Stage:        "production",
+		Service:      "carts",
+		Result:       "fail",
+		Labels:       map[string]string{"owner": "team-a"},
+		Data:         evaluation,
+		keptn:        KeptnDetails{BridgeURL: "https://keptn.example.com/bridge"},
+	}
+
+	tests := []struct {
+		name        string
+		task        string
+		templates   TemplateSettings
+		wantSubject string
+		wantBody    []string
+		wantNotBody []string
+		wantErr     bool
+	}{
+		{
+			name:        "built-in evaluation",
+			task:        keptnv2.EvaluationTaskName,
+			wantSubject: "[EVALUATION] sockshop - carts - production - Result: fail",
+			wantBody: []string{
+				"fail ❌",
+				"<td>42.5</td>",
+				"Response time",
+				`href="https://keptn.example.com/bridge/project/sockshop/sequence/ctx-1"`,
+			},
+		},
+		{
+			name:        "subject override",
+			task:        keptnv2.EvaluationTaskName,
+			templates:   TemplateSettings{Subject: "{{resultEmoji .Result}} {{.Service}} owned by {{index .Labels \"owner\"}}"},
+			wantSubject: "❌ carts owned by team-a",
+		},
+		{
+			name:        "body override",
+			task:        keptnv2.EvaluationTaskName,
+			templates:   TemplateSettings{Body: "<p>Score {{formatValue .Data.Evaluation.Score}} for {{.Project}}</p>"},
+			wantSubject: "[EVALUATION] sockshop - carts - production - Result: fail",
+			wantBody:    []string{"<p>Score 42.5 for sockshop</p>"},
+			wantNotBody: []string{"SLI Breakdown"},
+		},
+		{
+			name:        "body override with labels",
+			task:        keptnv2.EvaluationTaskName,
+			templates:   TemplateSettings{Body: "<p>{{index .Labels \"owner\"}}</p>"},
+			wantSubject: "[EVALUATION] sockshop - carts - production - Result: fail",
+			wantBody:    []string{"<p>team-a</p>"},
+		},
+		{
+			name:        "broken subject falls back to built-in",
+			task:        keptnv2.EvaluationTaskName,
+			templates:   TemplateSettings{Subject: "{{.Project"},
+			wantSubject: "[EVALUATION] sockshop - carts - production - Result: fail",
+		},
+		{
+			name:        "failing body falls back to built-in",
+			task:        keptnv2.EvaluationTaskName,
+			templates:   TemplateSettings{Body: "{{.Data.Unknown}}"},
+			wantSubject: "[EVALUATION] sockshop - carts - production - Result: fail",
+			wantBody:    []string{"SLI Breakdown"},
+		},
+		{
+			name:        "multi line subject is trimmed",
+			task:        keptnv2.EvaluationTaskName,
+			templates:   TemplateSettings{Subject: "\n  {{.Project}}  \n"},
+			wantSubject: "sockshop",
+		},
+		{
+			name:    "unknown task",
+			task:    "unknown",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := renderTicket(context.Background(), nil, tt.task, tt.templates, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderTicket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", subject, tt.wantSubject)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, body)
+				}
+			}
+			for _, unwanted := range tt.wantNotBody {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("body contains %q:\n%s", unwanted, body)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteHTMLTemplateEscapes(t *testing.T) {
+	data := ticketTemplateData{Service: `<script>alert("x")</script>`}
+	body, err := executeHTMLTemplate("test", "<p>{{.Service}}</p>", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body, "<script>") {
+		t.Errorf("body is not escaped: %s", body)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 12, want: "12"},
+		{value: 0.345, want: "0.345"},
+		{value: 100, want: "100"},
+		{value: 0, want: "0"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestResultEmoji(t *testing.T) {
+	tests := []struct {
+		result string
+		want   string
+	}{
+		{result: "pass", want: "✅"},
+		{result: "warning", want: "⚠"},
+		{result: "fail", want: "❌"},
+		{result: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := resultEmoji(tt.result); got != tt.want {
+			t.Errorf("resultEmoji(%q) = %q, want %q", tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestIndicatorName(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator *keptnv2.SLIEvaluationResult
+		want      string
+	}{
+		{name: "display name", indicator: &keptnv2.SLIEvaluationResult{DisplayName: "Response time", Value: &keptnv2.SLIResult{Metric: "response_time_p95"}}, want: "Response time"},
+		{name: "metric", indicator: &keptnv2.SLIEvaluationResult{Value: &keptnv2.SLIResult{Metric: "response_time_p95"}}, want: "response_time_p95"},
+		{name: "neither", indicator: &keptnv2.SLIEvaluationResult{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := indicatorName(tt.indicator); got != tt.want {
+				t.Errorf("indicatorName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndicatorTable(t *testing.T) {
+	tests := []struct {
+		name        string
+		indicator   *keptnv2.SLIEvaluationResult
+		wantRow     []string
+		wantNotRow  []string
+		highlighted bool
+	}{
+		{
+			name: "failed key SLI",
+			indicator: &keptnv2.SLIEvaluationResult{
+				DisplayName: "Response time",
+				Value:       &keptnv2.SLIResult{Metric: "response_time_p95", Value: 1200.5, Success: true},
+				PassTargets: []*keptnv2.SLITarget{
+					{Criteria: "<=800", TargetValue: 800, Violated: true},
+					{Criteria: "<=+10%", TargetValue: 990, Violated: true},
+				},
+				WarningTargets: []*keptnv2.SLITarget{{Criteria: "<=1000", TargetValue: 1000, Violated: true}},
+				Status:         "fail",
+				KeySLI:         true,
+			},
+			wantRow: []string{
+				"<strong>Response time</strong>",
+				"<td>1200.5</td>",
+				"&lt;=800 (target 800) ❌ violated<br>&lt;=&#43;10% (target 990) ❌ violated",
+				"<td>fail ❌</td>",
+				"<td>yes</td>",
+			},
+			highlighted: true,
+		},
+		{
+			name: "passed",
+			indicator: &keptnv2.SLIEvaluationResult{
+				Value:       &keptnv2.SLIResult{Metric: "error_rate", Value: 0.01, Success: true},
+				PassTargets: []*keptnv2.SLITarget{{Criteria: "<1", TargetValue: 1}},
+				Score:       1,
+				Status:      "pass",
+			},
+			wantRow:    []string{"<td>error_rate</td>", "<td>0.01</td>", "&lt;1 (target 1) ✅ met", "<td>1</td>", "<td>pass ✅</td>"},
+			wantNotRow: []string{"<strong>", "yes"},
+		},
+		{
+			name: "no value",
+			indicator: &keptnv2.SLIEvaluationResult{
+				Value:  &keptnv2.SLIResult{Metric: "throughput", Message: "no data points"},
+				Status: "warning",
+			},
+			wantRow: []string{"<td>n/a (no data points)</td>", "<td>warning ⚠</td>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := indicatorTable([]*keptnv2.SLIEvaluationResult{tt.indicator})
+			if err != nil {
+				t.Fatal(err)
+			}
+			row := string(table)
+			for _, want := range tt.wantRow {
+				if !strings.Contains(row, want) {
+					t.Errorf("table does not contain %q:\n%s", want, row)
+				}
+			}
+			for _, unwanted := range tt.wantNotRow {
+				if strings.Contains(row, unwanted) {
+					t.Errorf("table contains %q:\n%s", unwanted, row)
+				}
+			}
+			if highlighted := strings.Contains(row, "background-color"); highlighted != tt.highlighted {
+				t.Errorf("row highlighted = %v, want %v:\n%s", highlighted, tt.highlighted, row)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters for OTEL_TRACES_EXPORTER
+const (
+	tracesExporterNone   = "none"
+	tracesExporterOTLP   = "otlp"
+	tracesExporterStdout = "stdout"
+)
+
+// Span attributes shared by all spans of an event
+const (
+	keptnContextKey     = attribute.Key("keptn.context")
+	cloudEventIDKey     = attribute.Key("cloudevents.event_id")
+	cloudEventTypeKey   = attribute.Key("cloudevents.event_type")
+	cloudEventSourceKey = attribute.Key("cloudevents.event_source")
+	keptnTaskKey        = attribute.Key("keptn.task")
+	zendeskTicketIDKey  = attribute.Key("zendesk.ticket_id")
+	sinkNameKey         = attribute.Key("sink.name")
+	downstreamTargetKey = attribute.Key("downstream.target")
+)
+
+// CloudEvents distributed tracing extensions
+const (
+	traceparentExtension = "traceparent"
+	tracestateExtension  = "tracestate"
+)
+
+// Spans are no-ops until setupTracing installs a tracer provider
+var tracer = otel.Tracer("github.com/keptn-sandbox/zendesk-service")
+
+// W3C trace context, as carried by the traceparent / tracestate CloudEvent extensions
+var tracePropagator = propagation.TraceContext{}
+
+// Installs the tracer provider for OTEL_TRACES_EXPORTER:
+//   - otlp: OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* env vars (endpoint, headers, ...)
+//   - stdout: pretty printed spans, for local debugging
+//   - none: no tracing
+//
+// The returned function flushes pending spans and must be called before the service exits
+func setupTracing(ctx context.Context, exporterName string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterName {
+	case "", tracesExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case tracesExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case tracesExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q, expected %s, %s or %s", exporterName, tracesExporterOTLP, tracesExporterStdout, tracesExporterNone)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s trace exporter: %w", exporterName, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracePropagator)
+
+	slog.Info("Exporting traces", "exporter", exporterName)
+	return provider.Shutdown, nil
+}
+
+// Starts a span for an incoming event. Without a span in ctx it continues the trace of the
+// traceparent extension of the event, e.g. when the outbox worker picks up a persisted event
+func startEventSpan(ctx context.Context, name string, event cloudevents.Event) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = tracePropagator.Extract(ctx, eventTraceCarrier(event))
+	}
+
+	attributes := []attribute.KeyValue{
+		cloudEventIDKey.String(event.ID()),
+		cloudEventTypeKey.String(event.Type()),
+		cloudEventSourceKey.String(event.Source()),
+	}
+	if keptnContext, err := event.Context.GetExtension("shkeptncontext"); err == nil {
+		attributes = append(attributes, keptnContextKey.String(fmt.Sprint(keptnContext)))
+	}
+
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attributes...))
+}
+
+// Reads the W3C trace context from the CloudEvent extensions
+func eventTraceCarrier(event cloudevents.Event) traceCarrier {
+	carrier := traceCarrier{}
+	for _, name := range []string{traceparentExtension, tracestateExtension} {
+		if value, err := event.Context.GetExtension(name); err == nil {
+			carrier[name] = fmt.Sprint(value)
+		}
+	}
+	return carrier
+}
+
+// Stores the trace context of ctx in the CloudEvent extensions, so that the outbox worker continues the trace
+func setEventTraceContext(ctx context.Context, event *cloudevents.Event) {
+	carrier := traceCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	for name, value := range carrier {
+		event.SetExtension(name, value)
+	}
+}
+
+// traceCarrier is a propagation.TextMapCarrier backed by a map
+type traceCarrier map[string]string
+
+func (c traceCarrier) Get(key string) string        { return c[key] }
+func (c traceCarrier) Set(key string, value string) { c[key] = value }
+func (c traceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Ends a span, marking it as failed if err is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Wraps an http.RoundTripper so that every request gets a client span and a traceparent header
+func tracedTransport(target string, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx, span := tracer.Start(req.Context(), "HTTP "+req.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				downstreamTargetKey.String(target),
+				semconv.HTTPMethodKey.String(req.Method),
+				semconv.HTTPHostKey.String(req.URL.Host),
+				semconv.HTTPTargetKey.String(req.URL.Path),
+			))
+		defer span.End()
+
+		req = req.Clone(ctx)
+		tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return resp, err
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
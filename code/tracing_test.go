@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Records the spans of the service while the test runs
+func useTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := tracer
+	tracer = provider.Tracer("test")
+	t.Cleanup(func() { tracer = previous })
+	return recorder
+}
+
+// Returns the value of a span attribute, empty if the span does not have it
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSetupTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  bool
+	}{
+		{name: "default", exporter: ""},
+		{name: "none", exporter: tracesExporterNone},
+		{name: "unknown", exporter: "jaeger", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := setupTracing(context.Background(), tt.exporter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setupTracing(%q) error = %v, wantErr %v", tt.exporter, err, tt.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					t.Errorf("shutdown() = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStartEventSpan(t *testing.T) {
+	recorder := useTestTracer(t)
+	_, upstream := tracer.Start(context.Background(), "upstream")
+	upstream.End()
+	upstreamContext := upstream.SpanContext()
+	_, persisted := tracer.Start(context.Background(), "persisted")
+	persisted.End()
+
+	tests := []struct {
+		name string
+		// Span in the context of the handler
+		parent trace.SpanContext
+		// Trace context of the event, e.g. when it was persisted by the outbox
+		eventParent trace.SpanContext
+		wantParent  trace.SpanContext
+	}{
+		{name: "new trace"},
+		{name: "continues the trace of the event", eventParent: upstreamContext, wantParent: upstreamContext},
+		{name: "span in the context wins", parent: upstreamContext, eventParent: persisted.SpanContext(), wantParent: upstreamContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := newTestEvent(t, "sh.keptn.event.evaluation.finished", map[string]string{})
+			if tt.eventParent.IsValid() {
+				setEventTraceContext(trace.ContextWithSpanContext(context.Background(), tt.eventParent), &event)
+			}
+			ctx := context.Background()
+			if tt.parent.IsValid() {
+				ctx = trace.ContextWithSpanContext(ctx, tt.parent)
+			}
+
+			_, span := startEventSpan(ctx, "handleKeptnCloudEvent", event)
+			span.End()
+
+			ended := recorder.Ended()
+			got := ended[len(ended)-1]
+			if got.Parent().SpanID() != tt.wantParent.SpanID() {
+				t.Errorf("parent = %s, want %s", got.Parent().SpanID(), tt.wantParent.SpanID())
+			}
+			if tt.wantParent.IsValid() && got.SpanContext().TraceID() != tt.wantParent.TraceID() {
+				t.Errorf("trace = %s, want %s", got.SpanContext().TraceID(), tt.wantParent.TraceID())
+			}
+			if got.SpanKind() != trace.SpanKindConsumer {
+				t.Errorf("kind = %s, want consumer", got.SpanKind())
+			}
+			for key, want := range map[attribute.Key]string{cloudEventIDKey: "event-1", cloudEventTypeKey: "sh.keptn.event.evaluation.finished", keptnContextKey: "ctx-1"} {
+				if value := spanAttribute(got, key); value != want {
+					t.Errorf("%s = %q, want %q", key, value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEndSpan(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+		wantEvents int
+	}{
+		{name: "ok", wantStatus: codes.Unset},
+		{name: "failed", err: errors.New("zendesk is down"), wantStatus: codes.Error, wantEvents: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := useTestTracer(t)
+			_, span := tracer.Start(context.Background(), "createOrUpdateZendeskTicket")
+			endSpan(span, tt.err)
+
+			ended := recorder.Ended()
+			if len(ended) != 1 {
+				t.Fatalf("got %d ended spans, want 1", len(ended))
+			}
+			if ended[0].Status().Code != tt.wantStatus || len(ended[0].Events()) != tt.wantEvents {
+				t.Errorf("span status = %v with %d events, want %v with %d", ended[0].Status().Code, len(ended[0].Events()), tt.wantStatus, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestTracedTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		down       bool
+		wantStatus codes.Code
+	}{
+		{name: "ok", status: http.StatusOK, wantStatus: codes.Unset},
+		{name: "server error", status: http.StatusInternalServerError, wantStatus: codes.Error},
+		{name: "no response", down: true, wantStatus: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := useTestTracer(t)
+			traceparents := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceparents <- r.Header.Get("traceparent")
+				w.WriteHeader(tt.status)
+			}))
+			if tt.down {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+
+			client := &http.Client{Transport: tracedTransport(downstreamZendesk, http.DefaultTransport)}
+			resp, err := client.Get(server.URL + "/api/v2/users/me.json")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.down {
+				t.Fatalf("Get() error = %v, want error %v", err, tt.down)
+			}
+
+			ended := recorder.Ended()
+			if len(ended) != 1 {
+				t.Fatalf("got %d ended spans, want 1", len(ended))
+			}
+			span := ended[0]
+			if span.Name() != "HTTP GET" || span.SpanKind() != trace.SpanKindClient || span.Status().Code != tt.wantStatus {
+				t.Errorf("span = %s (%s) with status %v, want HTTP GET (client) with %v", span.Name(), span.SpanKind(), span.Status().Code, tt.wantStatus)
+			}
+			if target := spanAttribute(span, downstreamTargetKey); target != downstreamZendesk {
+				t.Errorf("%s = %q, want %q", downstreamTargetKey, target, downstreamZendesk)
+			}
+			if tt.down {
+				return
+			}
+			want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+			if traceparent := <-traceparents; traceparent != want {
+				t.Errorf("traceparent = %q, want %q", traceparent, want)
+			}
+		})
+	}
+}
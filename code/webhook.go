@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/google/uuid"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// Headers of Zendesk webhook requests, see https://developer.zendesk.com/documentation/event-connectors/webhooks/verifying/
+const (
+	zendeskSignatureHeader          = "X-Zendesk-Webhook-Signature"
+	zendeskSignatureTimestampHeader = "X-Zendesk-Webhook-Signature-Timestamp"
+)
+
+// Webhook requests with an older (or newer) signature timestamp are rejected to prevent replays
+const webhookMaxClockSkew = 5 * time.Minute
+
+const webhookMaxBodySize = 1 << 20
+
+// Ticket changes reported by the Zendesk triggers (the "change" field of the payload)
+const (
+	ticketChangeSolved   = "solved"
+	ticketChangeReopened = "reopened"
+	ticketChangeTagAdded = "tag_added"
+	ticketChangeComment  = "comment"
+)
+
+// Tags that make the service trigger a Keptn sequence for the project / stage / service of the ticket
+const (
+	evaluateLabel  = "keptn_evaluate"
+	remediateLabel = "keptn_remediate"
+)
+
+// Type of the events the service sends for ticket changes, e.g. sh.keptn.event.zendesk.ticket.solved
+const ticketChangedEventTypePrefix = "sh.keptn.event.zendesk.ticket."
+
+// zendeskWebhookPayload is the JSON body the Zendesk triggers send, e.g.
+//
+//	{
+//	  "ticket_id": "{{ticket.id}}",
+//	  "change": "solved",
+//	  "status": "{{ticket.status}}",
+//	  "subject": "{{ticket.title}}",
+//	  "tags": "{{ticket.tags}}",
+//	  "added_tags": "",
+//	  "external_id": "{{ticket.external_id}}",
+//	  "comment": "{{ticket.latest_comment}}",
+//	  "author": "{{current_user.name}}"
+//	}
+type zendeskWebhookPayload struct {
+	TicketID string `json:"ticket_id"`
+	Change   string `json:"change"`
+	Status   string `json:"status"`
+	Subject  string `json:"subject"`
+	Tags     string `json:"tags"`
+	// Tags the trigger reacts to, e.g. "keptn_evaluate". Only these start a Keptn sequence, so that
+	// tags added later do not trigger it again while the ticket still carries them
+	AddedTags  string `json:"added_tags"`
+	ExternalID string `json:"external_id"`
+	Comment    string `json:"comment"`
+	Author     string `json:"author"`
+}
+
+// TicketChangedEventData is the data of the sh.keptn.event.zendesk.ticket.* events
+type TicketChangedEventData struct {
+	keptnv2.EventData
+	Ticket TicketChange `json:"ticket"`
+}
+
+// TicketChange describes what happened to a Zendesk ticket
+type TicketChange struct {
+	ID        int64    `json:"id"`
+	URL       string   `json:"url"`
+	Change    string   `json:"change"`
+	Status    string   `json:"status,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	AddedTags []string `json:"addedTags,omitempty"`
+	Comment   string   `json:"comment,omitempty"`
+	Author    string   `json:"author,omitempty"`
+}
+
+// webhookReceiver accepts Zendesk webhooks on WEBHOOK_PORT / WEBHOOK_PATH and turns ticket changes into Keptn events
+// The signing secret is read from the live configuration for every request, so it can be rotated without a restart
+type webhookReceiver struct {
+	config *configSource
+	sender *keptnv2.HTTPEventSender
+	now    func() time.Time
+}
+
+func newWebhookReceiver(config *configSource) (*webhookReceiver, error) {
+	cfg := config.Load()
+	if cfg.WebhookSecret == "" {
+		return nil, fmt.Errorf("ZENDESK_WEBHOOK_SECRET must be set to receive Zendesk webhooks")
+	}
+	sender, err := keptnv2.NewHTTPEventSender(cfg.KeptnEventEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookReceiver{config: config, sender: sender, now: time.Now}, nil
+}
+
+// Starts the webhook server. It stops when ctx is done
+func (wr *webhookReceiver) listen(ctx context.Context, port int, path string) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, wr)
+	server := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: mux, ReadTimeout: 30 * time.Second, WriteTimeout: 30 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("Receiving Zendesk webhooks", "port", port, "path", path)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBodySize))
+	if err != nil {
+		http.Error(w, "could not read body", http.StatusBadRequest)
+		return
+	}
+
+	cfg := wr.config.Load()
+	if err := verifyZendeskSignature(cfg.WebhookSecret, r.Header.Get(zendeskSignatureHeader), r.Header.Get(zendeskSignatureTimestampHeader), body, wr.now()); err != nil {
+		slog.WarnContext(r.Context(), "Rejecting webhook", "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	payload := zendeskWebhookPayload{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event, err := ticketChangeEvent(cfg.Zendesk, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event == nil {
+		// Not a ticket of this service
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	ctx := withEventLogFields(r.Context(), *event)
+
+	// A webhook may decide a pending approval, no need to wait for the next poll. The check calls Zendesk
+	// and Keptn, so it is left to the poll loop instead of holding up the response
+	if pendingApprovals != nil {
+		if ticketID, err := strconv.ParseInt(payload.TicketID, 10, 64); err == nil {
+			pendingApprovals.requestCheck(ticketID)
+		}
+	}
+
+	if err := wr.send(ctx, *event); err != nil {
+		slog.ErrorContext(ctx, "Could not send Keptn event for ticket", "ticketID", payload.TicketID, "error", err)
+		http.Error(w, "could not send Keptn event", http.StatusBadGateway)
+		return
+	}
+	slog.InfoContext(ctx, "Sent Keptn event for ticket", "ticketID", payload.TicketID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (wr *webhookReceiver) send(ctx context.Context, event cloudevents.Event) error {
+	// In local mode events are only logged
+	if keptnOptions.UseLocalFileSystem {
+		slog.InfoContext(ctx, "env=local: not sending event", "event", event.String())
+		return nil
+	}
+	return wr.sender.SendEvent(event)
+}
+
+// Checks the signature of a Zendesk webhook: base64(HMAC-SHA256(secret, timestamp + body))
+func verifyZendeskSignature(secret string, signature string, timestamp string, body []byte, now time.Time) error {
+	if signature == "" || timestamp == "" {
+		return fmt.Errorf("missing %s or %s header", zendeskSignatureHeader, zendeskSignatureTimestampHeader)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	signedAt, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	if skew := now.Sub(signedAt); skew > webhookMaxClockSkew || skew < -webhookMaxClockSkew {
+		return fmt.Errorf("signature timestamp %s is too old", timestamp)
+	}
+	return nil
+}
+
+// Maps a ticket change onto a Keptn event. Returns nil if the ticket has no keptn_project / keptn_stage labels
+// Sequences are only triggered by the added_tags of the payload, not by the tags the ticket has anyway
+//   - tag keptn_evaluate added: sh.keptn.event.<stage>.evaluation.triggered (re-runs the evaluation of the last 5 minutes)
+//   - tag keptn_remediate added: sh.keptn.event.<stage>.remediation.triggered with the ticket as problem
+//   - anything else: sh.keptn.event.zendesk.ticket.<change>, in the Keptn context of the ticket if it has one
+func ticketChangeEvent(details ZendeskDetails, payload zendeskWebhookPayload) (*cloudevents.Event, error) {
+	ticketID, err := strconv.ParseInt(payload.TicketID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ticket_id %q", payload.TicketID)
+	}
+	switch payload.Change {
+	case ticketChangeSolved, ticketChangeReopened, ticketChangeTagAdded, ticketChangeComment:
+	default:
+		return nil, fmt.Errorf("unknown change %q, expected %s, %s, %s or %s", payload.Change, ticketChangeSolved, ticketChangeReopened, ticketChangeTagAdded, ticketChangeComment)
+	}
+
+	tags := strings.Fields(payload.Tags)
+	eventData := keptnv2.EventData{}
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, "keptn_project:"):
+			eventData.Project = strings.TrimPrefix(tag, "keptn_project:")
+		case strings.HasPrefix(tag, "keptn_stage:"):
+			eventData.Stage = strings.TrimPrefix(tag, "keptn_stage:")
+		case strings.HasPrefix(tag, "keptn_service:"):
+			eventData.Service = strings.TrimPrefix(tag, "keptn_service:")
+		}
+	}
+	if eventData.Project == "" || eventData.Stage == "" {
+		return nil, nil
+	}
+
+	addedTags := strings.Fields(payload.AddedTags)
+	added := map[string]bool{}
+	for _, tag := range addedTags {
+		added[tag] = true
+	}
+
+	ticketURL := details.TicketURL(ticketID)
+	keptnContext := payload.ExternalID
+
+	var eventType string
+	var data interface{}
+
+	switch {
+	case payload.Change == ticketChangeTagAdded && added[evaluateLabel]:
+		// A new sequence, so a new Keptn context
+		keptnContext = ""
+		eventType = keptnv2.GetTriggeredEventType(eventData.Stage + "." + keptnv2.EvaluationTaskName)
+		now := time.Now().UTC()
+		data = &keptnv2.EvaluationTriggeredEventData{
+			EventData: eventData,
+			Evaluation: keptnv2.Evaluation{
+				Start: now.Add(-5 * time.Minute).Format(time.RFC3339),
+				End:   now.Format(time.RFC3339),
+			},
+		}
+
+	case payload.Change == ticketChangeTagAdded && added[remediateLabel]:
+		keptnContext = ""
+		eventType = keptnv2.GetTriggeredEventType(eventData.Stage + "." + keptnv2.RemediationTaskName)
+		data = &keptnv2.RemediationTriggeredEventData{
+			EventData: eventData,
+			Problem: keptnv2.ProblemDetails{
+				State:        "OPEN",
+				ProblemID:    "zendesk-" + payload.TicketID,
+				ProblemTitle: payload.Subject,
+				ProblemURL:   ticketURL,
+			},
+		}
+
+	default:
+		change := payload.Change
+		if change == ticketChangeComment {
+			change = "commented"
+		} else if change == ticketChangeTagAdded {
+			change = "tagged"
+		}
+		eventType = ticketChangedEventTypePrefix + change
+		data = &TicketChangedEventData{
+			EventData: eventData,
+			Ticket: TicketChange{
+				ID:        ticketID,
+				URL:       ticketURL,
+				Change:    payload.Change,
+				Status:    payload.Status,
+				Tags:      tags,
+				AddedTags: addedTags,
+				Comment:   payload.Comment,
+				Author:    payload.Author,
+			},
+		}
+	}
+
+	if keptnContext == "" {
+		keptnContext = uuid.New().String()
+	}
+
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.New().String())
+	event.SetType(eventType)
+	event.SetSource(ServiceName)
+	event.SetTime(time.Now())
+	event.SetExtension("shkeptncontext", keptnContext)
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyZendeskSignature(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"ticket_id":"1"}`)
+	timestamp := now.Format(time.RFC3339)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		timestamp string
+		body      []byte
+		wantErr   bool
+	}{
+		{name: "valid", secret: "s3cret", signature: sign("s3cret", timestamp, body), timestamp: timestamp, body: body},
+		{name: "slightly in the future", secret: "s3cret", signature: sign("s3cret", now.Add(time.Minute).Format(time.RFC3339), body),
+			timestamp: now.Add(time.Minute).Format(time.RFC3339), body: body},
+		{name: "missing signature", secret: "s3cret", timestamp: timestamp, body: body, wantErr: true},
+		{name: "missing timestamp", secret: "s3cret", signature: sign("s3cret", "", body), body: body, wantErr: true},
+		{name: "wrong secret", secret: "s3cret", signature: sign("other", timestamp, body), timestamp: timestamp, body: body, wantErr: true},
+		{name: "tampered body", secret: "s3cret", signature: sign("s3cret", timestamp, body), timestamp: timestamp,
+			body: []byte(`{"ticket_id":"2"}`), wantErr: true},
+		{name: "too old", secret: "s3cret", signature: sign("s3cret", now.Add(-6*time.Minute).Format(time.RFC3339), body),
+			timestamp: now.Add(-6 * time.Minute).Format(time.RFC3339), body: body, wantErr: true},
+		{name: "too far in the future", secret: "s3cret", signature: sign("s3cret", now.Add(6*time.Minute).Format(time.RFC3339), body),
+			timestamp: now.Add(6 * time.Minute).Format(time.RFC3339), body: body, wantErr: true},
+		{name: "invalid timestamp", secret: "s3cret", signature: sign("s3cret", "yesterday", body), timestamp: "yesterday", body: body, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyZendeskSignature(tt.secret, tt.signature, tt.timestamp, tt.body, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyZendeskSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTicketChangeEvent(t *testing.T) {
+	details := ZendeskDetails{BaseURL: "https://acme.zendesk.com"}
+	keptnTags := "keptn_project:sockshop keptn_stage:production keptn_service:carts"
+
+	tests := []struct {
+		name        string
+		payload     zendeskWebhookPayload
+		wantType    string
+		wantNil     bool
+		wantErr     bool
+		wantContext string
+	}{
+		{
+			name:        "solved",
+			payload:     zendeskWebhookPayload{TicketID: "7", Change: "solved", Tags: keptnTags, ExternalID: "ctx-1"},
+			wantType:    "sh.keptn.event.zendesk.ticket.solved",
+			wantContext: "ctx-1",
+		},
+		{
+			name:     "reopened",
+			payload:  zendeskWebhookPayload{TicketID: "7", Change: "reopened", Tags: keptnTags},
+			wantType: "sh.keptn.event.zendesk.ticket.reopened",
+		},
+		{
+			name:     "comment",
+			payload:  zendeskWebhookPayload{TicketID: "7", Change: "comment", Tags: keptnTags},
+			wantType: "sh.keptn.event.zendesk.ticket.commented",
+		},
+		{
+			name:     "evaluate tag added",
+			payload:  zendeskWebhookPayload{TicketID: "7", Change: "tag_added", Tags: keptnTags + " keptn_evaluate", AddedTags: "keptn_evaluate", ExternalID: "ctx-1"},
+			wantType: keptnv2.GetTriggeredEventType("production." + keptnv2.EvaluationTaskName),
+		},
+		{
+			name:     "remediate tag added",
+			payload:  zendeskWebhookPayload{TicketID: "7", Change: "tag_added", Tags: keptnTags + " keptn_remediate", AddedTags: "keptn_remediate"},
+			wantType: keptnv2.GetTriggeredEventType("production." + keptnv2.RemediationTaskName),
+		},
+		{
+			name:        "other tag added to a ticket that still has keptn_evaluate",
+			payload:     zendeskWebhookPayload{TicketID: "7", Change: "tag_added", Tags: keptnTags + " keptn_evaluate urgent", AddedTags: "urgent", ExternalID: "ctx-1"},
+			wantType:    "sh.keptn.event.zendesk.ticket.tagged",
+			wantContext: "ctx-1",
+		},
+		{
+			name:     "tag added without added_tags",
+			payload:  zendeskWebhookPayload{TicketID: "7", Change: "tag_added", Tags: keptnTags + " keptn_evaluate"},
+			wantType: "sh.keptn.event.zendesk.ticket.tagged",
+		},
+		{
+			name:    "ticket without keptn tags",
+			payload: zendeskWebhookPayload{TicketID: "7", Change: "solved", Tags: "billing"},
+			wantNil: true,
+		},
+		{
+			name:    "ticket without stage",
+			payload: zendeskWebhookPayload{TicketID: "7", Change: "solved", Tags: "keptn_project:sockshop"},
+			wantNil: true,
+		},
+		{
+			name:    "invalid ticket_id",
+			payload: zendeskWebhookPayload{TicketID: "{{ticket.id}}", Change: "solved", Tags: keptnTags},
+			wantErr: true,
+		},
+		{
+			name:    "unknown change",
+			payload: zendeskWebhookPayload{TicketID: "7", Change: "deleted", Tags: keptnTags},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ticketChangeEvent(details, tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ticketChangeEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if event != nil {
+					t.Fatalf("ticketChangeEvent() = %s, want nil", event.Type())
+				}
+				return
+			}
+			if event == nil {
+				t.Fatal("ticketChangeEvent() = nil")
+			}
+			if event.Type() != tt.wantType {
+				t.Errorf("type = %q, want %q", event.Type(), tt.wantType)
+			}
+
+			keptnContext, _ := event.Extensions()["shkeptncontext"].(string)
+			if tt.wantContext != "" && keptnContext != tt.wantContext {
+				t.Errorf("shkeptncontext = %q, want %q", keptnContext, tt.wantContext)
+			}
+			if keptnContext == "" {
+				t.Error("shkeptncontext is empty")
+			}
+
+			data := keptnv2.EventData{}
+			if err := json.Unmarshal(event.Data(), &data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Project != "sockshop" || data.Stage != "production" || data.Service != "carts" {
+				t.Errorf("event data = %+v, want sockshop/production/carts", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package zendesk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Authenticator adds the credentials of a strategy to every request of a Client
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// refresher is implemented by authenticators whose credentials may be renewed. The Client invalidates
+// the credentials once when Zendesk answers 401 and sends the request again
+type refresher interface {
+	Invalidate()
+}
+
+// APITokenAuth authenticates as the given user with one of its API tokens (email/token basic auth)
+func APITokenAuth(email string, apiToken string) Authenticator {
+	return &apiTokenAuth{email: email, apiToken: apiToken}
+}
+
+type apiTokenAuth struct {
+	email    string
+	apiToken string
+}
+
+func (a *apiTokenAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.email+"/token", a.apiToken)
+	return nil
+}
+
+// BearerTokenAuth sends an OAuth access token that was issued beforehand, e.g. by an administrator
+func BearerTokenAuth(accessToken string) Authenticator {
+	return &bearerTokenAuth{accessToken: accessToken}
+}
+
+type bearerTokenAuth struct {
+	accessToken string
+}
+
+func (a *bearerTokenAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.accessToken)
+	return nil
+}
+
+// Tokens are renewed this long before Zendesk says they expire
+const tokenExpiryMargin = time.Minute
+
+// ClientCredentials identify an OAuth client of Zendesk, see
+// https://developer.zendesk.com/api-reference/ticketing/oauth/grant_type_tokens/#client-credentials-grant-type
+type ClientCredentials struct {
+	// Token endpoint, e.g. https://acme.zendesk.com/oauth/tokens
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// Space separated, e.g. "tickets:read tickets:write"
+	Scope string
+}
+
+// ClientCredentialsAuth requests access tokens with the client credentials grant and renews them shortly
+// before they expire. Tokens without expiry are kept until Zendesk rejects them
+// Token requests are sent through httpClient, nil means a default http.Client (30s timeout)
+func ClientCredentialsAuth(credentials ClientCredentials, httpClient *http.Client) Authenticator {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &clientCredentialsAuth{credentials: credentials, httpClient: httpClient, now: time.Now}
+}
+
+type clientCredentialsAuth struct {
+	credentials ClientCredentials
+	httpClient  *http.Client
+	now         func() time.Time
+
+	// Serializes token requests, so that concurrent calls share one token
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// Seconds, 0 if the token does not expire
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func (a *clientCredentialsAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := a.token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *clientCredentialsAuth) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accessToken = ""
+}
+
+// Returns the cached access token, or requests a new one if there is none or it is about to expire
+func (a *clientCredentialsAuth) token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.accessToken != "" && (a.expiresAt.IsZero() || a.now().Before(a.expiresAt.Add(-tokenExpiryMargin))) {
+		return a.accessToken, nil
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     a.credentials.ClientID,
+		"client_secret": a.credentials.ClientSecret,
+		"scope":         a.credentials.Scope,
+	})
+	if err != nil {
+		return "", fmt.Errorf("zendesk: could not encode token request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.credentials.TokenURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("zendesk: could not create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return "", &transportError{err: fmt.Errorf("zendesk: token request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", &transportError{err: fmt.Errorf("zendesk: could not read token response: %w", err)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", newAPIError(resp, body)
+	}
+
+	token := tokenResponse{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("zendesk: could not decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("zendesk: token response of %s has no access_token", a.credentials.TokenURL)
+	}
+
+	a.accessToken = token.AccessToken
+	a.expiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expiresAt = a.now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return a.accessToken, nil
+}
@@ -0,0 +1,149 @@
+package zendesk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts a Zendesk whose token endpoint issues token-1, token-2, ... and whose API accepts the tokens valid says are valid
+func newOAuthServer(t *testing.T, expiresIn int64, valid func(token string) bool) (*httptest.Server, *int32, *int32) {
+	t.Helper()
+	var tokens, calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth/tokens" {
+			n := atomic.AddInt32(&tokens, 1)
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		if !valid(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_token"}`))
+			return
+		}
+		w.Write([]byte(`{"user":{"id":1,"role":"agent"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &tokens, &calls
+}
+
+func TestClientCredentialsAuthToken(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresIn int64
+		// Time of the second request after the first one
+		later      time.Duration
+		wantTokens int32
+		wantToken  string
+	}{
+		{name: "cached", expiresIn: 3600, later: 30 * time.Minute, wantTokens: 1, wantToken: "token-1"},
+		{name: "renewed shortly before it expires", expiresIn: 3600, later: time.Hour - tokenExpiryMargin, wantTokens: 2, wantToken: "token-2"},
+		{name: "expired", expiresIn: 60, later: 2 * time.Minute, wantTokens: 2, wantToken: "token-2"},
+		{name: "without expiry", later: 24 * time.Hour, wantTokens: 1, wantToken: "token-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, tokens, _ := newOAuthServer(t, tt.expiresIn, func(string) bool { return true })
+			auth := ClientCredentialsAuth(ClientCredentials{TokenURL: server.URL + "/oauth/tokens", ClientID: "keptn", ClientSecret: "secret"}, nil).(*clientCredentialsAuth)
+			now := start
+			auth.now = func() time.Time { return now }
+
+			if _, err := auth.token(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(tt.later)
+			token, err := auth.token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.wantToken || atomic.LoadInt32(tokens) != tt.wantTokens {
+				t.Errorf("token = %s after %d token requests, want %s after %d", token, atomic.LoadInt32(tokens), tt.wantToken, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsAuthTokenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "rejected client", status: http.StatusUnauthorized, body: `{"error":"invalid_client"}`, wantErr: "401"},
+		{name: "no access token", status: http.StatusOK, body: `{"token_type":"bearer"}`, wantErr: "has no access_token"},
+		{name: "not json", status: http.StatusOK, body: `<html>`, wantErr: "could not decode token response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			auth := ClientCredentialsAuth(ClientCredentials{TokenURL: server.URL, ClientID: "keptn", ClientSecret: "secret"}, nil)
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/users/me.json", nil)
+			err := auth.Authenticate(context.Background(), req)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Authenticate() = %v, want %q", err, tt.wantErr)
+			}
+			if header := req.Header.Get("Authorization"); header != "" {
+				t.Errorf("Authorization = %q, want none", header)
+			}
+		})
+	}
+}
+
+func TestClientRenewsTokenOn401(t *testing.T) {
+	tests := []struct {
+		name string
+		// Tokens the API accepts
+		valid      func(token string) bool
+		bearer     bool
+		wantErr    bool
+		wantTokens int32
+		wantCalls  int32
+	}{
+		{name: "valid token", valid: func(string) bool { return true }, wantTokens: 1, wantCalls: 1},
+		{name: "revoked token is renewed", valid: func(token string) bool { return token != "token-1" }, wantTokens: 2, wantCalls: 2},
+		{name: "renewed once", valid: func(string) bool { return false }, wantErr: true, wantTokens: 2, wantCalls: 2},
+		{name: "static bearer token is not renewed", valid: func(string) bool { return false }, bearer: true, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, tokens, calls := newOAuthServer(t, 3600, tt.valid)
+			auth := ClientCredentialsAuth(ClientCredentials{TokenURL: server.URL + "/oauth/tokens", ClientID: "keptn", ClientSecret: "secret"}, nil)
+			if tt.bearer {
+				auth = BearerTokenAuth("token-1")
+			}
+			client, err := NewClient(server.URL, auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = client.CurrentUser(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CurrentUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !hasStatus(err, http.StatusUnauthorized) {
+				t.Errorf("CurrentUser() error = %v, want a 401", err)
+			}
+			if atomic.LoadInt32(tokens) != tt.wantTokens || atomic.LoadInt32(calls) != tt.wantCalls {
+				t.Errorf("token requests = %d, API calls = %d, want %d and %d", atomic.LoadInt32(tokens), atomic.LoadInt32(calls), tt.wantTokens, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Package zendesk is a small client for the parts of the Zendesk Support API used by the zendesk-service
+package zendesk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Client talks to a single Zendesk instance
+type Client struct {
+	baseURL    string
+	auth       Authenticator
+	userAgent  string
+	httpClient *http.Client
+
+	retry   RetryPolicy
+	budget  *retryBudget
+	limits  *rateLimitTracker
+	onRetry func(context.Context, RetryInfo)
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http.Client (30s timeout)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// NewClient creates a client for the Zendesk instance at baseURL (e.g. https://acme.zendesk.com)
+// Requests are authenticated by auth, e.g. APITokenAuth
+func NewClient(baseURL string, auth Authenticator, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("zendesk: invalid base URL %q: %w", baseURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("zendesk: base URL %q must be an absolute http(s) URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		auth:       auth,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retry:      DefaultRetryPolicy(),
+		limits:     &rateLimitTracker{},
+	}
+	c.budget = newRetryBudget(c.retry)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// BaseURL returns the Zendesk base URL without trailing slash
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// TicketURL returns the agent UI link for a ticket
+func (c *Client) TicketURL(id int64) string {
+	return c.baseURL + "/agent/tickets/" + strconv.FormatInt(id, 10)
+}
+
+// CreateRequest creates a ticket as the authenticated end user (POST /api/v2/requests.json)
+func (c *Client) CreateRequest(ctx context.Context, request *Request) (*Request, error) {
+	out := requestEnvelope{}
+	if err := c.do(ctx, http.MethodPost, "/api/v2/requests.json", requestEnvelope{Request: request}, &out); err != nil {
+		return nil, err
+	}
+	return out.Request, nil
+}
+
+// GetRequest fetches a ticket as the authenticated end user (GET /api/v2/requests/{id}.json)
+// Unlike GetTicket it is available to end users, but it does not return the tags
+func (c *Client) GetRequest(ctx context.Context, id int64) (*Request, error) {
+	out := requestEnvelope{}
+	if err := c.do(ctx, http.MethodGet, "/api/v2/requests/"+strconv.FormatInt(id, 10)+".json", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Request, nil
+}
+
+// UpdateRequest adds a comment to a ticket as the authenticated end user and may mark it as solved
+// (PUT /api/v2/requests/{id}.json). Tags, status and the other fields cannot be changed this way
+func (c *Client) UpdateRequest(ctx context.Context, id int64, request *Request) (*Request, error) {
+	out := requestEnvelope{}
+	if err := c.do(ctx, http.MethodPut, "/api/v2/requests/"+strconv.FormatInt(id, 10)+".json", requestEnvelope{Request: request}, &out); err != nil {
+		return nil, err
+	}
+	return out.Request, nil
+}
+
+// CreateTicket creates a ticket through the agent Tickets API (POST /api/v2/tickets.json)
+func (c *Client) CreateTicket(ctx context.Context, ticket *Ticket) (*Ticket, error) {
+	out := ticketEnvelope{}
+	if err := c.do(ctx, http.MethodPost, "/api/v2/tickets.json", ticketEnvelope{Ticket: ticket}, &out); err != nil {
+		return nil, err
+	}
+	return out.Ticket, nil
+}
+
+// GetTicket fetches a single ticket (GET /api/v2/tickets/{id}.json)
+func (c *Client) GetTicket(ctx context.Context, id int64) (*Ticket, error) {
+	out := ticketEnvelope{}
+	if err := c.do(ctx, http.MethodGet, ticketPath(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Ticket, nil
+}
+
+// UpdateTicket applies the non-empty fields of ticket to an existing ticket (PUT /api/v2/tickets/{id}.json)
+func (c *Client) UpdateTicket(ctx context.Context, id int64, ticket *Ticket) (*Ticket, error) {
+	out := ticketEnvelope{}
+	if err := c.do(ctx, http.MethodPut, ticketPath(id), ticketEnvelope{Ticket: ticket}, &out); err != nil {
+		return nil, err
+	}
+	return out.Ticket, nil
+}
+
+// ListTicketsByExternalID returns all tickets carrying the given external_id (GET /api/v2/tickets.json?external_id=)
+func (c *Client) ListTicketsByExternalID(ctx context.Context, externalID string) ([]Ticket, error) {
+	out := ticketsEnvelope{}
+	path := "/api/v2/tickets.json?external_id=" + url.QueryEscape(externalID)
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Tickets, nil
+}
+
+// SearchTickets returns all tickets matching a Zendesk search query, e.g. `status<solved tags:foo`
+// "type:ticket" is added to the query. Results are fetched page by page (GET /api/v2/search.json)
+func (c *Client) SearchTickets(ctx context.Context, query string) ([]Ticket, error) {
+	tickets := []Ticket{}
+	path := "/api/v2/search.json?query=" + url.QueryEscape("type:ticket "+query)
+	for path != "" {
+		out := searchEnvelope{}
+		if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, out.Results...)
+
+		path = ""
+		if out.NextPage != "" {
+			next, err := url.Parse(out.NextPage)
+			if err != nil {
+				return nil, fmt.Errorf("zendesk: invalid next_page %q: %w", out.NextPage, err)
+			}
+			path = next.RequestURI()
+		}
+	}
+	return tickets, nil
+}
+
+// CurrentUser returns the user the client authenticates as (GET /api/v2/users/me.json)
+// It is a cheap way to verify the credentials
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	out := userEnvelope{}
+	if err := c.do(ctx, http.MethodGet, "/api/v2/users/me.json", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+// AddComment appends a comment to an existing ticket
+func (c *Client) AddComment(ctx context.Context, id int64, comment Comment) (*Ticket, error) {
+	return c.UpdateTicket(ctx, id, &Ticket{Comment: &comment})
+}
+
+func ticketPath(id int64) string {
+	return "/api/v2/tickets/" + strconv.FormatInt(id, 10) + ".json"
+}
+
+// do sends a JSON request to Zendesk and decodes the JSON response into out
+// 429, 5xx and transport errors are retried according to the RetryPolicy, POSTs only if they were not processed, see isRetryable
+// A 401 renews the credentials once if the Authenticator supports it
+// Non-2xx responses are returned as *APIError
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		payload, err = json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("zendesk: could not encode request: %w", err)
+		}
+	}
+
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		// Slow down before Zendesk starts throttling us
+		if err := sleep(ctx, c.limits.delay(time.Now(), c.retry.SlowDownBelow)); err != nil {
+			return err
+		}
+
+		err := c.send(ctx, method, path, payload, out)
+		if err == nil {
+			c.budget.deposit()
+			return nil
+		}
+
+		// The access token expired or was revoked. Renewing it does not count as a retry
+		if r, ok := c.auth.(refresher); ok && hasStatus(err, http.StatusUnauthorized) && !reauthenticated {
+			r.Invalidate()
+			reauthenticated = true
+			attempt--
+			continue
+		}
+
+		if attempt >= c.retry.MaxAttempts || !isRetryable(ctx, method, err) || !c.budget.withdraw() {
+			return err
+		}
+
+		wait := c.retry.backoff(attempt)
+		if limited := c.limits.delay(time.Now(), c.retry.SlowDownBelow); limited > wait {
+			wait = limited
+		}
+		if c.onRetry != nil {
+			c.onRetry(ctx, RetryInfo{Method: method, Path: path, Attempt: attempt, Wait: wait, Err: err})
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// isDialError reports whether err happened while connecting, i.e. before the request was written
+func isDialError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// send performs a single attempt of a call
+func (c *Client) send(ctx context.Context, method string, path string, payload []byte, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("zendesk: could not create request: %w", err)
+	}
+	if err := c.auth.Authenticate(ctx, req); err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &transportError{err: fmt.Errorf("zendesk: %s %s failed: %w", method, path, err), notSent: isDialError(err)}
+	}
+	defer resp.Body.Close()
+
+	c.limits.update(resp.Header, time.Now())
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &transportError{err: fmt.Errorf("zendesk: could not read response of %s %s: %w", method, path, err)}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp, respBody)
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("zendesk: could not decode response of %s %s: %w", method, path, err)
+		}
+	}
+	return nil
+}
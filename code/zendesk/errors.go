@@ -0,0 +1,131 @@
+package zendesk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned whenever Zendesk answers with a non-2xx status code
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+
+	// Title and Description are taken from the Zendesk error payload when present
+	Title       string
+	Description string
+	Details     map[string][]ErrorDetail
+
+	// Body holds the raw response body if it could not be decoded
+	Body string
+
+	// Zendesk sent a Retry-After header, i.e. the request was not processed and may be sent again
+	retryAfter bool
+}
+
+// ErrorDetail is a single validation error reported by Zendesk
+type ErrorDetail struct {
+	Error       string `json:"error"`
+	Description string `json:"description"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("zendesk: %s %s returned %d", e.Method, e.URL, e.StatusCode)
+	if e.Title != "" {
+		msg += ": " + e.Title
+	}
+	if e.Description != "" {
+		msg += " (" + e.Description + ")"
+	}
+	for field, details := range e.Details {
+		for _, detail := range details {
+			msg += fmt.Sprintf("; %s: %s", field, detail.Description)
+		}
+	}
+	if e.Title == "" && e.Description == "" && e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed if retried later
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// IsNotFound reports whether err is a Zendesk 404
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnprocessable reports whether err is a Zendesk 422, e.g. when updating a closed ticket
+func IsUnprocessable(err error) bool {
+	return hasStatus(err, http.StatusUnprocessableEntity)
+}
+
+// IsForbidden reports whether err is a Zendesk 401 or 403, e.g. when an end user calls an agent-only endpoint
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized) || hasStatus(err, http.StatusForbidden)
+}
+
+// IsTemporary reports whether err is worth retrying later: rate limits, 5xx and network errors
+func IsTemporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var transportErr *transportError
+	return errors.As(err, &transportErr)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// newAPIError decodes the two error shapes Zendesk uses:
+//
+//	{"error": "RecordInvalid", "description": "...", "details": {...}}
+//	{"error": {"title": "Forbidden", "message": "..."}}
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		retryAfter: resp.Header.Get("Retry-After") != "",
+	}
+
+	var payload struct {
+		Error       json.RawMessage          `json:"error"`
+		Description string                   `json:"description"`
+		Details     map[string][]ErrorDetail `json:"details"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		apiErr.Body = string(body)
+		return apiErr
+	}
+
+	apiErr.Description = payload.Description
+	apiErr.Details = payload.Details
+
+	var title string
+	var nested struct {
+		Title   string `json:"title"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(payload.Error, &title); err == nil {
+		apiErr.Title = title
+	} else if err := json.Unmarshal(payload.Error, &nested); err == nil {
+		apiErr.Title = nested.Title
+		if apiErr.Description == "" {
+			apiErr.Description = nested.Message
+		}
+	}
+
+	if apiErr.Title == "" && apiErr.Description == "" {
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
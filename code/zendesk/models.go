@@ -0,0 +1,109 @@
+package zendesk
+
+import "time"
+
+// Ticket status values as used by Zendesk
+const (
+	StatusNew     = "new"
+	StatusOpen    = "open"
+	StatusPending = "pending"
+	StatusHold    = "hold"
+	StatusSolved  = "solved"
+	StatusClosed  = "closed"
+)
+
+// Role of the users that may only use the Requests API, see User
+const RoleEndUser = "end-user"
+
+// Request is an end-user request as handled by the Requests API (/api/v2/requests.json)
+// A request and the ticket it creates share the same ID. Replaces ZDRequest and ZDResponseRequest of 0.8.2
+type Request struct {
+	ID          int64      `json:"id,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Requester   *Requester `json:"requester,omitempty"`
+	Subject     string     `json:"subject,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	Comment     *Comment   `json:"comment,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	// Solved marks the request as solved on update, the only status change end users may make
+	Solved    bool       `json:"solved,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Ticket is a ticket as handled by the agent Tickets API (/api/v2/tickets.json)
+type Ticket struct {
+	ID          int64    `json:"id,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	ExternalID  string   `json:"external_id,omitempty"`
+	Subject     string   `json:"subject,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// AdditionalTags and RemoveTags modify the tags of an existing ticket without replacing them
+	AdditionalTags []string      `json:"additional_tags,omitempty"`
+	RemoveTags     []string      `json:"remove_tags,omitempty"`
+	RequesterID    int64         `json:"requester_id,omitempty"`
+	Requester      *Requester    `json:"requester,omitempty"`
+	GroupID        int64         `json:"group_id,omitempty"`
+	AssigneeID     int64         `json:"assignee_id,omitempty"`
+	CustomFields   []CustomField `json:"custom_fields,omitempty"`
+	Comment        *Comment      `json:"comment,omitempty"`
+	CreatedAt      *time.Time    `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time    `json:"updated_at,omitempty"`
+}
+
+// CustomField is the value of a ticket field of the Zendesk instance, e.g. a dropdown or a text field
+// Multi-select fields take a list of option tags
+type CustomField struct {
+	ID    int64       `json:"id"`
+	Value interface{} `json:"value"`
+}
+
+// Requester identifies the person a request or ticket is raised on behalf of. Replaces ZDRequester of 0.8.2
+type Requester struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// User is a Zendesk user. The anonymous user Zendesk reports for unauthenticated requests has no ID
+type User struct {
+	ID     int64  `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Role   string `json:"role,omitempty"`
+	Active bool   `json:"active,omitempty"`
+}
+
+// Comment is a ticket comment. Set either Body (plain text) or HTMLBody. Replaces ZDComment of 0.8.2
+// Public defaults to true on the Zendesk side when left nil
+type Comment struct {
+	Body     string `json:"body,omitempty"`
+	HTMLBody string `json:"html_body,omitempty"`
+	Public   *bool  `json:"public,omitempty"`
+}
+
+// Wrappers matching the JSON envelopes Zendesk expects and returns
+type requestEnvelope struct {
+	Request *Request `json:"request"`
+}
+
+type ticketEnvelope struct {
+	Ticket *Ticket `json:"ticket"`
+}
+
+type ticketsEnvelope struct {
+	Tickets []Ticket `json:"tickets"`
+}
+
+type userEnvelope struct {
+	User *User `json:"user"`
+}
+
+type searchEnvelope struct {
+	Results  []Ticket `json:"results"`
+	NextPage string   `json:"next_page"`
+}
@@ -0,0 +1,239 @@
+package zendesk
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how calls that fail with 429, 5xx or a transport error are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per call, including the first one
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the jittered exponential backoff
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Retries are paid from a budget shared by all calls of a Client
+	// Every retry costs one token and every successful call earns BudgetRatio tokens, up to BudgetMax
+	// This stops a struggling Zendesk from being hammered by retries of many concurrent events
+	BudgetMax   float64
+	BudgetRatio float64
+	// SlowDownBelow is the fraction of the rate limit left at which calls start being spaced out
+	SlowDownBelow float64
+}
+
+// DefaultRetryPolicy retries up to 3 times, waiting between 1s and 30s
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   4,
+		BaseDelay:     time.Second,
+		MaxDelay:      30 * time.Second,
+		BudgetMax:     20,
+		BudgetRatio:   0.2,
+		SlowDownBelow: 0.1,
+	}
+}
+
+// RetryInfo describes a retry that is about to happen
+type RetryInfo struct {
+	Method  string
+	Path    string
+	Attempt int
+	Wait    time.Duration
+	Err     error
+}
+
+// RateLimitStatus is the last rate limit reported by Zendesk
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	// Known is false until Zendesk sent rate limit headers
+	Known bool
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+		c.budget = newRetryBudget(policy)
+	}
+}
+
+// WithRetryNotify registers a callback that is invoked before every retry with the context of the call
+func WithRetryNotify(notify func(context.Context, RetryInfo)) Option {
+	return func(c *Client) {
+		c.onRetry = notify
+	}
+}
+
+// RateLimit returns the rate limit headroom last reported by Zendesk
+func (c *Client) RateLimit() RateLimitStatus {
+	return c.limits.status()
+}
+
+// backoff returns a "full jitter" exponential backoff for the given attempt (1-based)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if ceiling > float64(p.MaxDelay) {
+		ceiling = float64(p.MaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// isRetryable reports whether a failed call should be attempted again
+// Calls that create something (POST) may have succeeded although they failed, so they are only retried
+// if Zendesk certainly did not process them: a 429 or 503 with Retry-After, or a connection that could not be opened
+func isRetryable(ctx context.Context, method string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if method != http.MethodPost {
+		// API errors with 429 / 5xx and transport errors (connection refused, timeouts, ...)
+		return IsTemporary(err)
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusServiceUnavailable) && apiErr.retryAfter
+	}
+	var transportErr *transportError
+	return errors.As(err, &transportErr) && transportErr.notSent
+}
+
+// transportError marks failures where no HTTP response was received
+type transportError struct {
+	err error
+	// notSent is true if the request certainly did not reach Zendesk, e.g. the connection was refused
+	notSent bool
+}
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryBudget is a token bucket limiting the share of retries across all calls
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+func newRetryBudget(policy RetryPolicy) *retryBudget {
+	return &retryBudget{tokens: policy.BudgetMax, max: policy.BudgetMax, ratio: policy.BudgetRatio}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+}
+
+// rateLimitTracker remembers the X-Rate-Limit headers of the last response
+// and the Retry-After of the last 429 so that the next calls can be delayed
+type rateLimitTracker struct {
+	mu           sync.Mutex
+	limit        int
+	remaining    int
+	known        bool
+	resetAt      time.Time
+	blockedUntil time.Time
+}
+
+// Zendesk uses a one minute window for its account wide rate limit
+const rateLimitWindow = time.Minute
+
+func (t *rateLimitTracker) update(header http.Header, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limit, errLimit := strconv.Atoi(header.Get("X-Rate-Limit"))
+	remaining, errRemaining := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	if errLimit == nil && errRemaining == nil && limit > 0 {
+		t.limit = limit
+		t.remaining = remaining
+		t.known = true
+		t.resetAt = now.Add(rateLimitWindow)
+		if reset, err := strconv.Atoi(header.Get("ratelimit-reset")); err == nil {
+			t.resetAt = now.Add(time.Duration(reset) * time.Second)
+		}
+	}
+
+	if wait, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+		t.blockedUntil = now.Add(wait)
+	}
+}
+
+// delay returns how long to wait before the next call
+// It honours a pending Retry-After and spreads the remaining calls of the
+// current window evenly once the headroom drops below slowDownBelow
+func (t *rateLimitTracker) delay(now time.Time, slowDownBelow float64) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Before(t.blockedUntil) {
+		return t.blockedUntil.Sub(now)
+	}
+	if !t.known || !now.Before(t.resetAt) {
+		return 0
+	}
+	if t.remaining <= 0 {
+		return t.resetAt.Sub(now)
+	}
+	if float64(t.remaining) < float64(t.limit)*slowDownBelow {
+		return t.resetAt.Sub(now) / time.Duration(t.remaining+1)
+	}
+	return 0
+}
+
+func (t *rateLimitTracker) status() RateLimitStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return RateLimitStatus{Limit: t.limit, Remaining: t.remaining, Known: t.known}
+}
+
+// parseRetryAfter supports both forms of the header: delay-seconds and HTTP-date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
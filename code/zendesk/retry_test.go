@@ -0,0 +1,226 @@
+package zendesk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{attempt: 1, ceiling: time.Second},
+		{attempt: 2, ceiling: 2 * time.Second},
+		{attempt: 3, ceiling: 4 * time.Second},
+		{attempt: 4, ceiling: 8 * time.Second},
+		{attempt: 5, ceiling: 10 * time.Second},
+		{attempt: 50, ceiling: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt %d", tt.attempt), func(t *testing.T) {
+			// Full jitter: any value between 0 and the ceiling
+			for i := 0; i < 100; i++ {
+				if wait := policy.backoff(tt.attempt); wait < 0 || wait > tt.ceiling {
+					t.Fatalf("backoff(%d) = %s, want between 0 and %s", tt.attempt, wait, tt.ceiling)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "empty", value: ""},
+		{name: "seconds", value: "30", want: 30 * time.Second, wantOK: true},
+		{name: "zero seconds", value: "0", want: 0, wantOK: true},
+		{name: "negative seconds", value: "-5"},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second, wantOK: true},
+		{name: "http date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "garbage", value: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRateLimitTracker(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		at      time.Duration
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "no headers", want: 0},
+		{name: "plenty left", headers: map[string]string{"X-Rate-Limit": "700", "X-Rate-Limit-Remaining": "500"}, want: 0, wantOK: true},
+		{name: "below slow down threshold", headers: map[string]string{"X-Rate-Limit": "700", "X-Rate-Limit-Remaining": "9"},
+			want: time.Minute / 10, wantOK: true},
+		{name: "below threshold with reset", headers: map[string]string{"X-Rate-Limit": "700", "X-Rate-Limit-Remaining": "9", "ratelimit-reset": "20"},
+			want: 2 * time.Second, wantOK: true},
+		{name: "exhausted", headers: map[string]string{"X-Rate-Limit": "700", "X-Rate-Limit-Remaining": "0"}, want: time.Minute, wantOK: true},
+		{name: "exhausted window passed", headers: map[string]string{"X-Rate-Limit": "700", "X-Rate-Limit-Remaining": "0"},
+			at: 2 * time.Minute, want: 0, wantOK: true},
+		{name: "invalid limit", headers: map[string]string{"X-Rate-Limit": "many", "X-Rate-Limit-Remaining": "0"}, want: 0},
+		{name: "retry after", headers: map[string]string{"Retry-After": "45"}, want: 45 * time.Second},
+		{name: "retry after half way", headers: map[string]string{"Retry-After": "45"}, at: 15 * time.Second, want: 30 * time.Second},
+		{name: "retry after wins over headroom", headers: map[string]string{"X-Rate-Limit": "700", "X-Rate-Limit-Remaining": "500", "Retry-After": "5"},
+			want: 5 * time.Second, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+			tracker := &rateLimitTracker{}
+			tracker.update(header, now)
+
+			if got := tracker.delay(now.Add(tt.at), 0.1); got != tt.want {
+				t.Errorf("delay() = %s, want %s", got, tt.want)
+			}
+			if status := tracker.status(); status.Known != tt.wantOK {
+				t.Errorf("status().Known = %v, want %v", status.Known, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		want   bool
+	}{
+		{name: "get 500", method: http.MethodGet, err: &APIError{StatusCode: 500}, want: true},
+		{name: "get 429", method: http.MethodGet, err: &APIError{StatusCode: 429}, want: true},
+		{name: "get 404", method: http.MethodGet, err: &APIError{StatusCode: 404}},
+		{name: "get timeout", method: http.MethodGet, err: &transportError{err: readErr}, want: true},
+		{name: "put 503", method: http.MethodPut, err: &APIError{StatusCode: 503}, want: true},
+		{name: "post 500", method: http.MethodPost, err: &APIError{StatusCode: 500}},
+		{name: "post 503", method: http.MethodPost, err: &APIError{StatusCode: 503}},
+		{name: "post 503 with retry after", method: http.MethodPost, err: &APIError{StatusCode: 503, retryAfter: true}, want: true},
+		{name: "post 429 with retry after", method: http.MethodPost, err: &APIError{StatusCode: 429, retryAfter: true}, want: true},
+		{name: "post 502 with retry after", method: http.MethodPost, err: &APIError{StatusCode: 502, retryAfter: true}},
+		{name: "post connection refused", method: http.MethodPost, err: &transportError{err: dialErr, notSent: true}, want: true},
+		{name: "post connection reset", method: http.MethodPost, err: &transportError{err: readErr}},
+		{name: "other error", method: http.MethodGet, err: errors.New("could not decode")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(context.Background(), tt.method, tt.err); got != tt.want {
+				t.Errorf("isRetryable(%s, %v) = %v, want %v", tt.method, tt.err, got, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if isRetryable(ctx, http.MethodGet, &APIError{StatusCode: 500}) {
+		t.Error("isRetryable() = true for a cancelled context")
+	}
+}
+
+func TestIsDialError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "dial", err: fmt.Errorf("post: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), want: true},
+		{name: "dns", err: fmt.Errorf("post: %w", &net.DNSError{Err: "no such host", Name: "acme.zendesk.com"}), want: true},
+		{name: "read", err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}},
+		{name: "timeout", err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDialError(tt.err); got != tt.want {
+				t.Errorf("isDialError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		status       int
+		retryAfter   string
+		wantAttempts int32
+	}{
+		{name: "get 500 is retried", method: http.MethodGet, status: 500, wantAttempts: 3},
+		{name: "create 500 is not retried", method: http.MethodPost, status: 500, wantAttempts: 1},
+		{name: "create 503 is not retried", method: http.MethodPost, status: 503, wantAttempts: 1},
+		{name: "create 503 with retry after is retried", method: http.MethodPost, status: 503, retryAfter: "0", wantAttempts: 3},
+		{name: "create 429 with retry after is retried", method: http.MethodPost, status: 429, retryAfter: "0", wantAttempts: 3},
+		{name: "create 422 is not retried", method: http.MethodPost, status: 422, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			policy := DefaultRetryPolicy()
+			policy.MaxAttempts = 3
+			policy.BaseDelay = time.Millisecond
+			policy.MaxDelay = time.Millisecond
+			client, err := NewClient(server.URL, APITokenAuth("jane@example.com", "token"), WithRetryPolicy(policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.method == http.MethodPost {
+				_, err = client.CreateTicket(context.Background(), &Ticket{Subject: "test"})
+			} else {
+				_, err = client.GetTicket(context.Background(), 1)
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
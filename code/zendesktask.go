@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// Name of the Keptn task this service executes, i.e. sh.keptn.event.zendesk.triggered
+const zendeskTaskName = "zendesk"
+
+// ZendeskTriggeredEventData is the data of sh.keptn.event.zendesk.triggered
+// The properties of the zendesk task in the shipyard end up in Zendesk, e.g.
+//
+//	tasks:
+//	  - name: "zendesk"
+//	    properties:
+//	      subject: "{{.Service}} is about to be released to {{.Stage}}"
+//	      priority: high
+//	      tags: ["release-notes"]
+type ZendeskTriggeredEventData struct {
+	keptnv2.EventData
+	Zendesk ZendeskTaskProperties `json:"zendesk"`
+}
+
+// ZendeskTaskProperties control the ticket of a zendesk task. Empty fields fall back to zendesk.yaml and the built-in templates
+type ZendeskTaskProperties struct {
+	// Subject is a text/template for the ticket subject
+	Subject string `json:"subject,omitempty"`
+	// Body is an html/template for the ticket body
+	Body     string   `json:"body,omitempty"`
+	Priority string   `json:"priority,omitempty"`
+	GroupID  int64    `json:"groupId,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// NewTicket opens a ticket of its own instead of updating the ticket of the sequence
+	NewTicket bool `json:"newTicket,omitempty"`
+}
+
+// ZendeskFinishedEventData is the data of sh.keptn.event.zendesk.finished
+type ZendeskFinishedEventData struct {
+	keptnv2.EventData
+	Zendesk ZendeskTaskResult `json:"zendesk"`
+}
+
+// ZendeskTaskResult tells the next tasks of the sequence which ticket was created or updated
+type ZendeskTaskResult struct {
+	TicketID  int64  `json:"ticketId,omitempty"`
+	TicketURL string `json:"ticketUrl,omitempty"`
+}
+
+// Executes the zendesk task of a shipyard sequence: sends zendesk.started, creates or updates
+// the ticket of the sequence and sends zendesk.finished with the ticket ID and URL
+// A ticket Zendesk rejects is reported as errored zendesk.finished so that the sequence does not wait forever.
+// Rate limits and outages are returned as transient errors, so that the event is redelivered
+// The ticket is recorded in memory before zendesk.finished is sent, a redelivery after a failed send only sends it again
+func HandleZendeskTriggeredEvent(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data *ZendeskTriggeredEventData) error {
+	slog.InfoContext(ctx, "Handling zendesk.triggered event")
+
+	key := idempotencyKey(incomingEvent, myKeptn.KeptnContext)
+	ticketID, created := zendeskTaskTickets.get(key)
+	if !created {
+		if _, err := myKeptn.SendTaskStartedEvent(&keptnv2.EventData{}, ServiceName); err != nil {
+			slog.WarnContext(ctx, "Could not send zendesk.started", "error", err)
+		}
+	}
+
+	finished := &ZendeskFinishedEventData{
+		EventData: keptnv2.EventData{
+			Status: keptnv2.StatusSucceeded,
+			Result: keptnv2.ResultPass,
+		},
+	}
+
+	var err error
+	if !created {
+		ticketID, err = createZendeskTicketForZendeskTriggered(ctx, cfg, myKeptn, data)
+		if err != nil && !isPermanent(err) {
+			return err
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not create Zendesk ticket", "error", err)
+		finished.Status = keptnv2.StatusErrored
+		finished.Result = keptnv2.ResultFailed
+		finished.Message = "Could not create Zendesk ticket: " + err.Error()
+	} else {
+		zendeskTaskTickets.set(key, ticketID)
+		ticketURL := cfg.Zendesk.TicketURL(ticketID)
+		finished.Zendesk = ZendeskTaskResult{TicketID: ticketID, TicketURL: ticketURL}
+		finished.Message = "Zendesk ticket " + ticketURL
+	}
+
+	if _, err := myKeptn.SendTaskFinishedEvent(finished, ServiceName); err != nil {
+		// The sequence waits for zendesk.finished, so have the event redelivered
+		return transientError(fmt.Errorf("could not send zendesk.finished: %w", err))
+	}
+	zendeskTaskTickets.forget(key)
+
+	// Sinks are only notified once, with the zendesk.finished that was sent
+	if finished.Zendesk.TicketID != 0 {
+		notifySinks(ctx, Notification{
+			Kind:         zendeskTaskName,
+			TicketID:     finished.Zendesk.TicketID,
+			TicketURL:    finished.Zendesk.TicketURL,
+			KeptnContext: myKeptn.KeptnContext,
+			EventID:      incomingEvent.ID(),
+			Project:      data.EventData.GetProject(),
+			Stage:        data.EventData.GetStage(),
+			Service:      data.EventData.GetService(),
+			Result:       string(data.Result),
+			Properties:   createCustomPropertiesForZendeskTriggeredEvents(cfg, myKeptn, data, finished.Zendesk.TicketURL),
+		})
+	}
+	return nil
+}
+
+// Recorded tickets of tasks that were not handed over are forgotten after this long, see taskTicketRecord
+const zendeskTaskTicketRetention = 24 * time.Hour
+
+// taskTicketRecord remembers the tickets created for triggered events (by idempotency key) until
+// the task has been handed over, e.g. zendesk.finished was sent, so that a redelivered event does not create a second ticket
+type taskTicketRecord struct {
+	mu      sync.Mutex
+	tickets map[string]recordedTicket
+}
+
+type recordedTicket struct {
+	id         int64
+	recordedAt time.Time
+}
+
+var (
+	zendeskTaskTickets = &taskTicketRecord{tickets: map[string]recordedTicket{}}
+	// Approvals approval.started was sent for and their tickets (0 until created), until the approval is persisted or finished
+	approvalTickets = &taskTicketRecord{tickets: map[string]recordedTicket{}}
+)
+
+func (r *taskTicketRecord) get(key string) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ticket, ok := r.tickets[key]
+	return ticket.id, ok
+}
+
+func (r *taskTicketRecord) set(key string, ticketID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for k, ticket := range r.tickets {
+		if now.Sub(ticket.recordedAt) > zendeskTaskTicketRetention {
+			delete(r.tickets, k)
+		}
+	}
+	r.tickets[key] = recordedTicket{id: ticketID, recordedAt: now}
+}
+
+func (r *taskTicketRecord) forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tickets, key)
+}
+
+func createZendeskTicketForZendeskTriggered(ctx context.Context, cfg *Config, myKeptn *keptnv2.Keptn, data *ZendeskTriggeredEventData) (int64, error) {
+	slog.DebugContext(ctx, "Creating Zendesk body details for zendesk.triggered")
+
+	// Task properties win over zendesk.yaml
+	settings := loadZendeskConfig(ctx, myKeptn).SettingsFor(zendeskTaskName)
+	properties := data.Zendesk
+	if properties.Subject != "" {
+		settings.Template.Subject = properties.Subject
+	}
+	if properties.Body != "" {
+		settings.Template.Body = properties.Body
+		settings.Template.BodyResource = ""
+	}
+	if properties.Priority != "" {
+		if !validPriorities[properties.Priority] {
+			return 0, permanentError(fmt.Errorf("invalid priority %q", properties.Priority))
+		}
+		settings.Priority = properties.Priority
+	}
+	if properties.GroupID != 0 {
+		settings.GroupID = properties.GroupID
+	}
+
+	templateData := newTicketTemplateData(cfg, myKeptn, data.EventData, string(data.Result), data)
+	title, bodyContent, err := renderTicket(ctx, myKeptn, zendeskTaskName, settings.Template, templateData)
+	if err != nil {
+		return 0, permanentError(err)
+	}
+
+	labels := append(createZendeskLabels(zendeskTaskName, data.EventData, string(data.Result)), settings.Tags...)
+	labels = append(labels, properties.Tags...)
+
+	ticket := zendeskTicket{
+		KeptnContext: myKeptn.KeptnContext,
+		Subject:      title,
+		Body:         bodyContent,
+		Labels:       labels,
+		Status:       ticketStatusForResult(string(data.Result), false),
+		Priority:     settings.Priority,
+		GroupID:      settings.GroupID,
+		Type:         settings.Type,
+		Agent:        settings.agentFields(),
+		Standalone:   properties.NewTicket,
+	}
+
+	return createOrUpdateZendeskTicket(ctx, cfg, ticket)
+}
+
+func createCustomPropertiesForZendeskTriggeredEvents(cfg *Config, myKeptn *keptnv2.Keptn, data *ZendeskTriggeredEventData, ticketURL string) map[string]string {
+	var customProperties = make(map[string]string)
+
+	customProperties["Keptn Project"] = data.EventData.GetProject()
+	customProperties["Keptn Service"] = data.EventData.GetService()
+	customProperties["Keptn Stage"] = data.EventData.GetStage()
+	customProperties["Ticket"] = ticketURL
+	customProperties["SentBy"] = "Keptn"
+	customProperties["BridgeURL"] = cfg.Keptn.BridgeLink(data.EventData.GetProject(), myKeptn.KeptnContext)
+	customProperties["Description"] = "Keptn Zendesk Task"
+
+	return customProperties
+}
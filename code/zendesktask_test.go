@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+)
+
+// Returns a Keptn handler for a .triggered event that records the events it sends instead of sending them
+// zendesk.yaml is not found
+func triggeredKeptnHandler(t *testing.T, event cloudevents.Event) (*keptnv2.Keptn, *fake.EventSender) {
+	t.Helper()
+	options := keptnOptions
+	keptnOptions.ConfigurationServiceURL = fakeConfigurationService(t, nil, 0).URL
+	t.Cleanup(func() { keptnOptions = options })
+
+	myKeptn, err := newKeptnHandler(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &fake.EventSender{}
+	myKeptn.EventSender = sender
+	return myKeptn, sender
+}
+
+func TestHandleZendeskTriggeredEvent(t *testing.T) {
+	created := fakeResponse{status: http.StatusCreated, body: `{"request":{"id":7}}`}
+	ok := fakeResponse{status: http.StatusOK, body: `{}`}
+	started := keptnv2.GetStartedEventType(zendeskTaskName)
+	finished := keptnv2.GetFinishedEventType(zendeskTaskName)
+
+	tests := []struct {
+		name       string
+		properties ZendeskTaskProperties
+		responses  map[string]fakeResponse
+		// Ticket recorded by an earlier delivery of the event
+		recorded      int64
+		finishedFails bool
+		wantErr       bool
+		wantTransient bool
+		wantCalls     []string
+		wantEvents    []string
+		wantStatus    keptnv2.StatusType
+		wantTicketID  int64
+		wantSubject   string
+		wantTags      []string
+		wantRecorded  bool
+	}{
+		{
+			name:         "ticket of the sequence",
+			responses:    map[string]fakeResponse{"POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			wantCalls:    []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+			wantEvents:   []string{started, finished},
+			wantStatus:   keptnv2.StatusSucceeded,
+			wantTicketID: 7,
+			wantSubject:  "[KEPTN] carts in sockshop/production",
+		},
+		{
+			name:         "task properties",
+			properties:   ZendeskTaskProperties{Subject: "{{.Service}} goes to {{.Stage}}", Priority: "high", Tags: []string{"release-notes"}, NewTicket: true},
+			responses:    map[string]fakeResponse{"POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			wantCalls:    []string{"POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+			wantEvents:   []string{started, finished},
+			wantStatus:   keptnv2.StatusSucceeded,
+			wantTicketID: 7,
+			wantSubject:  "carts goes to production",
+			wantTags:     []string{"release-notes"},
+		},
+		{
+			name:       "invalid priority",
+			properties: ZendeskTaskProperties{Priority: "asap"},
+			wantEvents: []string{started, finished},
+			wantStatus: keptnv2.StatusErrored,
+		},
+		{
+			name:       "zendesk rejects the ticket",
+			responses:  map[string]fakeResponse{"POST /api/v2/requests.json": {status: http.StatusUnprocessableEntity}},
+			wantCalls:  []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json"},
+			wantEvents: []string{started, finished},
+			wantStatus: keptnv2.StatusErrored,
+		},
+		{
+			name:          "rate limited",
+			responses:     map[string]fakeResponse{"POST /api/v2/requests.json": {status: http.StatusTooManyRequests}},
+			wantErr:       true,
+			wantTransient: true,
+			wantCalls:     []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json"},
+			wantEvents:    []string{started},
+		},
+		{
+			name:          "zendesk.finished not sent",
+			responses:     map[string]fakeResponse{"POST /api/v2/requests.json": created, "PUT /api/v2/tickets/7.json": ok},
+			finishedFails: true,
+			wantErr:       true,
+			wantTransient: true,
+			wantCalls:     []string{"GET /api/v2/tickets.json", "POST /api/v2/requests.json", "PUT /api/v2/tickets/7.json"},
+			wantEvents:    []string{started},
+			wantRecorded:  true,
+		},
+		{
+			name:         "redelivery after zendesk.finished was not sent",
+			recorded:     7,
+			wantEvents:   []string{finished},
+			wantStatus:   keptnv2.StatusSucceeded,
+			wantTicketID: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &ZendeskTriggeredEventData{
+				EventData: keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts", Result: keptnv2.ResultPass},
+				Zendesk:   tt.properties,
+			}
+			event := newTestEvent(t, keptnv2.GetTriggeredEventType(zendeskTaskName), data)
+			myKeptn, sender := triggeredKeptnHandler(t, event)
+			if tt.finishedFails {
+				sender.AddReactor(finished, func(event cloudevents.Event) error { return errors.New("event broker is down") })
+			}
+			key := idempotencyKey(event, myKeptn.KeptnContext)
+			if tt.recorded != 0 {
+				zendeskTaskTickets.set(key, tt.recorded)
+			}
+			defer zendeskTaskTickets.forget(key)
+			defer correlator.forget(myKeptn.KeptnContext)
+
+			zd := newFakeZendesk(t, tt.responses)
+			err := HandleZendeskTriggeredEvent(context.Background(), fakeZendeskConfig(zd), myKeptn, event, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleZendeskTriggeredEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && isPermanent(err) == tt.wantTransient {
+				t.Errorf("isPermanent(%v) = %v, want transient %v", err, !tt.wantTransient, tt.wantTransient)
+			}
+			if calls := zd.called(); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if err := sender.AssertSentEventTypes(tt.wantEvents); err != nil {
+				t.Errorf("sent events: %v", err)
+			}
+			if _, recorded := zendeskTaskTickets.get(key); recorded != tt.wantRecorded {
+				t.Errorf("ticket recorded = %v, want %v", recorded, tt.wantRecorded)
+			}
+			if tt.wantSubject != "" {
+				request := zd.body("POST /api/v2/requests.json")
+				if !strings.Contains(request, `"subject":"`+tt.wantSubject+`"`) {
+					t.Errorf("request = %s, want subject %q", request, tt.wantSubject)
+				}
+				for _, tag := range tt.wantTags {
+					if !strings.Contains(request, `"`+tag+`"`) {
+						t.Errorf("request = %s, want tag %q", request, tag)
+					}
+				}
+			}
+
+			if tt.wantStatus == "" {
+				return
+			}
+			sent := sender.SentEvents[len(sender.SentEvents)-1]
+			finishedData := &ZendeskFinishedEventData{}
+			if err := sent.DataAs(finishedData); err != nil {
+				t.Fatal(err)
+			}
+			if finishedData.Status != tt.wantStatus || finishedData.Zendesk.TicketID != tt.wantTicketID {
+				t.Errorf("zendesk.finished = %s with ticket %d, want %s with ticket %d", finishedData.Status, finishedData.Zendesk.TicketID, tt.wantStatus, tt.wantTicketID)
+			}
+			if tt.wantTicketID != 0 && finishedData.Zendesk.TicketURL != zd.URL+"/agent/tickets/7" {
+				t.Errorf("ticket URL = %s", finishedData.Zendesk.TicketURL)
+			}
+		})
+	}
+}
+
+func TestTaskTicketRecord(t *testing.T) {
+	record := &taskTicketRecord{tickets: map[string]recordedTicket{}}
+	record.tickets["ctx-0/expired"] = recordedTicket{id: 1, recordedAt: time.Now().Add(-zendeskTaskTicketRetention - time.Minute)}
+
+	tests := []struct {
+		name   string
+		update func()
+		key    string
+		wantID int64
+		wantOK bool
+	}{
+		{name: "unknown", key: "ctx-1/event-1"},
+		{name: "recorded", update: func() { record.set("ctx-1/event-1", 7) }, key: "ctx-1/event-1", wantID: 7, wantOK: true},
+		{name: "started without a ticket", update: func() { record.set("ctx-2/event-2", 0) }, key: "ctx-2/event-2", wantOK: true},
+		{name: "expired records are dropped", key: "ctx-0/expired"},
+		{name: "forgotten", update: func() { record.forget("ctx-1/event-1") }, key: "ctx-1/event-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.update != nil {
+				tt.update()
+			}
+			if id, ok := record.get(tt.key); id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("get(%s) = %d, %v, want %d, %v", tt.key, id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}